@@ -1,25 +1,64 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"github.com/stephendotcarter/planchecker/plan"
+	"log"
 	"os"
 )
 
 func main() {
+	// -config, -threshold, -enable, -disable and -analyze-script
+	flags := plan.AddFlags(flag.CommandLine)
+	flag.Parse()
+
+	// Without the parser output the ANALYZE script can be run as it is
+	base := plan.Options{Logger: log.New(os.Stdout, "", 0)}
+	if flags.AnalyzeScript {
+		base.Logger = nil
+	}
+
+	opts, err := flags.Options(base)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		os.Exit(1)
+	}
+
 	// Read filename from arguments
-	filename := os.Args[1]
+	filename := flag.Arg(0)
 
-	// Create new explain object
-	var explain plan.Explain
+	f, err := os.Open(filename)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
 
-	// Init the explain from filename
-	err := explain.InitFromFile(filename, true)
+	// Init an explain for each plan in the input
+	explains, err := plan.ParseAll(context.Background(), f, opts)
 	if err != nil {
 		fmt.Printf("%s\n", err)
 		os.Exit(1)
 	}
 
-	// Print Plan
-	explain.PrintPlan()
+	// Print the ANALYZE script as SQL
+	if flags.AnalyzeScript {
+		for i, explain := range explains {
+			if len(explains) > 1 {
+				fmt.Printf("\n-- Plan %d of %d\n", i+1, len(explains))
+			}
+			fmt.Print(explain.AnalyzeScript())
+		}
+		return
+	}
+
+	// Print Plans
+	for i, explain := range explains {
+		if len(explains) > 1 {
+			fmt.Printf("\n========== Plan %d of %d ==========\n", i+1, len(explains))
+		}
+		explain.PrintPlan()
+	}
 }
@@ -0,0 +1,59 @@
+package plan
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Lines per second the parser should keep up with, see the Benchmarks
+// section of the README
+const targetLinesPerSecond = 100000
+
+// Reports lines/s and how far it is from targetLinesPerSecond as
+// %target, compare them before and after changing the parser
+//     go test -run XXX -bench . ./plan/
+func benchmarkParse(b *testing.B, files []string) {
+	inputs := []string{}
+	lines := 0
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			b.Fatal(err)
+		}
+		inputs = append(inputs, string(data))
+		lines += strings.Count(string(data), "\n") + 1
+	}
+
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		for _, input := range inputs {
+			if _, err := ParseAll(context.Background(), strings.NewReader(input), Options{}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	rate := float64(lines*b.N) / time.Since(start).Seconds()
+	b.ReportMetric(rate, "lines/s")
+	b.ReportMetric(100*rate/targetLinesPerSecond, "%target")
+	if rate < targetLinesPerSecond {
+		b.Logf("%.0f lines/s is below the target of %d lines/s", rate, targetLinesPerSecond)
+	}
+}
+
+func BenchmarkParse_corpus(b *testing.B) {
+	files, err := filepath.Glob("../testdata/explain*")
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkParse(b, files)
+}
+
+// 6,000 line plan
+func BenchmarkParse_large(b *testing.B) {
+	benchmarkParse(b, []string{"../testdata/explain19.txt"})
+}
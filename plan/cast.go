@@ -0,0 +1,249 @@
+package plan
+
+import (
+	"regexp"
+	"strings"
+)
+
+var castPatterns = map[string]*regexp.Regexp{
+	// o.insertion_order_id::integer, imp."time"::date, (d.brief_code)::integer
+	"CAST_COLUMN": regexp.MustCompile(`^\(?((?:[A-Za-z_][A-Za-z0-9_$]*|"[^"]+")(?:\.(?:[A-Za-z_][A-Za-z0-9_$]*|"[^"]+"))*)\)?(?:::([A-Za-z_][A-Za-z0-9_ .]*?(?:\[\])?))?$`),
+	// ''::date, 5, (-1.5)::numeric
+	"CAST_LITERAL": regexp.MustCompile(`^\(?(?:''|-?[0-9][0-9.]*)\)?(?:::([A-Za-z_][A-Za-z0-9_ .]*?(?:\[\])?))?$`),
+	"COMPARISON":   regexp.MustCompile(`^ (=|<>|!=|<=|>=|<|>) `),
+	"BOOLEAN":      regexp.MustCompile(`(?i)^ (AND|OR) `),
+}
+
+// A column and the type it is cast to, Type is empty without a cast
+type ColumnCast struct {
+	Column string
+	Type   string
+}
+
+func (c ColumnCast) String() string {
+	if c.Type == "" {
+		return c.Column
+	}
+	return c.Column + "::" + c.Type
+}
+
+// Column in one side of a comparison, ok is false for anything else
+// e.g. a literal or a function call
+func parseColumnCast(expr string) (ColumnCast, bool) {
+	m := castPatterns["CAST_COLUMN"].FindStringSubmatch(strings.TrimSpace(expr))
+	if m == nil {
+		return ColumnCast{}, false
+	}
+	return ColumnCast{m[1], strings.TrimSpace(m[2])}, true
+}
+
+// Type one side of a comparison is cast to, empty without a cast. ok is
+// false for sides which are not a column or a literal, e.g. a function
+// call
+func parseSideType(expr string) (string, bool) {
+	if c, ok := parseColumnCast(expr); ok {
+		return c.Type, true
+	}
+	m := castPatterns["CAST_LITERAL"].FindStringSubmatch(strings.TrimSpace(expr))
+	if m == nil {
+		return "", false
+	}
+	return strings.TrimSpace(m[1]), true
+}
+
+// Varchar and char columns are shown cast to text when compared, which
+// does not change how they are hashed
+func isTextType(t string) bool {
+	switch strings.TrimPrefix(t, "pg_catalog.") {
+	case "text", "character varying", "varchar", "character", "bpchar":
+		return true
+	}
+	return false
+}
+
+// Positions of the matches of re outside of parentheses and quoted
+// identifiers. re must be anchored with ^
+func topLevelMatches(expr string, re *regexp.Regexp) [][]int {
+	matches := [][]int{}
+	depth := 0
+	quoted := false
+	for i := 0; i < len(expr); i++ {
+		switch c := expr[i]; {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0:
+			if loc := re.FindStringIndex(expr[i:]); loc != nil {
+				matches = append(matches, []int{i + loc[0], i + loc[1]})
+				i += loc[1] - 1
+			}
+		}
+	}
+	return matches
+}
+
+// The parentheses around expr belong together, not (a) = (b)
+func isParenthesised(expr string) bool {
+	if !strings.HasPrefix(expr, "(") || !strings.HasSuffix(expr, ")") {
+		return false
+	}
+	inner := expr[1 : len(expr)-1]
+	depth := 0
+	for _, c := range inner {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth < 0 {
+			return false
+		}
+	}
+	return depth == 0
+}
+
+// Comparisons in a condition, split on AND and OR at every level of
+// parentheses
+//     (a.x = b.y OR (c.z::integer = d.w AND e.v > 1))
+//     ->  [a.x = b.y, c.z::integer = d.w, e.v > 1]
+func splitCondition(cond string) []string {
+	cond = strings.TrimSpace(cond)
+	for isParenthesised(cond) {
+		cond = strings.TrimSpace(cond[1 : len(cond)-1])
+	}
+
+	matches := topLevelMatches(cond, castPatterns["BOOLEAN"])
+	if len(matches) == 0 {
+		return []string{cond}
+	}
+	parts := []string{}
+	start := 0
+	for _, loc := range append(matches, []int{len(cond), len(cond)}) {
+		parts = append(parts, splitCondition(cond[start:loc[0]])...)
+		start = loc[1]
+	}
+	return parts
+}
+
+// A comparison in a condition casting a column to another type
+type castMismatch struct {
+	Condition string       // The comparison, e.g. o.insertion_order_id::integer = d.brief_code::integer
+	Casts     []ColumnCast // Only the casted columns
+	Columns   []string     // Every column compared
+	Text      bool         // Both sides cast to the same text type, varchar and char columns are always shown with one
+}
+
+// Comparisons in a condition where a column is cast
+//     o.insertion_order_id::integer = d.brief_code::integer AND ac.campaign_sc::text = d.adserver_campaign_id::text
+//     ->  [o.insertion_order_id::integer = d.brief_code::integer, ac.campaign_sc::text = d.adserver_campaign_id::text (Text)]
+func castMismatches(cond string) []castMismatch {
+	mismatches := []castMismatch{}
+	cond = exprPatterns["LITERAL"].ReplaceAllString(cond, "''")
+
+	for _, part := range splitCondition(cond) {
+		comparisons := topLevelMatches(part, castPatterns["COMPARISON"])
+		if len(comparisons) == 0 {
+			continue
+		}
+		loc := comparisons[0]
+
+		m := castMismatch{Condition: part, Casts: []ColumnCast{}, Columns: []string{}}
+		types := []string{}
+		text := true
+		for _, side := range []string{part[:loc[0]], part[loc[1]:]} {
+			if t, ok := parseSideType(side); ok {
+				types = append(types, t)
+			}
+			c, ok := parseColumnCast(side)
+			if !ok {
+				continue
+			}
+			m.Columns = append(m.Columns, c.Column)
+			if c.Type != "" {
+				m.Casts = append(m.Casts, c)
+				text = text && isTextType(c.Type)
+			}
+		}
+		if len(m.Casts) == 0 {
+			continue
+		}
+
+		// varchar = integer::text is always reported, varchar::text =
+		// varchar::text is marked as it may not be a cast at all. When a
+		// side is not understood only casts to other types than text are
+		// reported
+		if len(types) == 2 {
+			m.Text = types[0] == types[1] && isTextType(types[0])
+		} else if text {
+			continue
+		}
+		mismatches = append(mismatches, m)
+	}
+
+	return mismatches
+}
+
+// Casts in the Hash Cond and Merge Cond of a join
+func (n *Node) joinCastMismatches() []castMismatch {
+	return append(castMismatches(n.HashCond), castMismatches(n.MergeCond)...)
+}
+
+// The join a motion sends its rows to, nil if there is another motion or
+// no join above it
+func (n *Node) inputJoin() *Node {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.IsJoin() {
+			return p
+		}
+		if p.MotionType != "" {
+			return nil
+		}
+	}
+	return nil
+}
+
+func containsCast(list []ColumnCast, c ColumnCast) bool {
+	for _, v := range list {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Hash Keys of a Redistribute Motion which are casts in the conditions,
+// and the comparisons they are for
+func (n *Node) redistributedCasts(mismatches []castMismatch) ([]ColumnCast, []castMismatch) {
+	keys := []ColumnCast{}
+	caused := []castMismatch{}
+	if n.MotionType != "Redistribute" {
+		return keys, caused
+	}
+
+	for _, m := range mismatches {
+		found := false
+		for _, key := range n.HashKey {
+			k, ok := parseColumnCast(key)
+			if !ok || k.Type == "" {
+				continue
+			}
+			for _, c := range m.Casts {
+				if c == k {
+					found = true
+					if !containsCast(keys, k) {
+						keys = append(keys, k)
+					}
+				}
+			}
+		}
+		if found {
+			caused = append(caused, m)
+		}
+	}
+	return keys, caused
+}
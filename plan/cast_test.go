@@ -0,0 +1,93 @@
+package plan
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCastMismatches(t *testing.T) {
+	tests := map[string][]string{
+		"o.insertion_order_id::integer = d.brief_code::integer AND ac.campaign_sc::text = d.adserver_campaign_id::text": {"o.insertion_order_id::integer = d.brief_code::integer", "ac.campaign_sc::text = d.adserver_campaign_id::text (text)"},
+		`(imp."time")::date = adwd_imp.date_dt`:                                  {`(imp."time")::date = adwd_imp.date_dt`},
+		"(created_at::date >= '2016-01-01'::date) AND (id = 5)":                  {"created_at::date >= ''::date"},
+		"agg.activity_ctgy_id = t.activity_ctgy_id":                              {},
+		"to_date(imp.click_time::text, 'MM-DD-YYYY'::text) = adwd_click.date_dt": {},
+		"account_id::text = '1-C7-4426'::text":                                   {"account_id::text = ''::text (text)"},
+		"(a.x = b.y OR c.z::integer = d.w)":                                      {"c.z::integer = d.w"},
+		"((a.x)::text = b.y OR (c.z::integer = d.w AND e.v > 1))":                {"(a.x)::text = b.y", "c.z::integer = d.w"},
+		"a.v = b.i::text":                    {"a.v = b.i::text"},
+		"a.v::text = b.i::character varying": {"a.v::text = b.i::character varying"},
+		"a.v::text = lower(b.v)":             {},
+	}
+
+	for input, expected := range tests {
+		conditions := []string{}
+		for _, m := range castMismatches(input) {
+			if m.Text {
+				conditions = append(conditions, m.Condition+" (text)")
+			} else {
+				conditions = append(conditions, m.Condition)
+			}
+		}
+		if !reflect.DeepEqual(conditions, expected) {
+			t.Errorf("%q: expected %v, got %v", input, expected, conditions)
+		}
+	}
+
+	m := castMismatches("o.insertion_order_id::integer = d.brief_code")[0]
+	if !reflect.DeepEqual(m.Casts, []ColumnCast{{"o.insertion_order_id", "integer"}}) || !reflect.DeepEqual(m.Columns, []string{"o.insertion_order_id", "d.brief_code"}) {
+		t.Errorf("Unexpected mismatch %+v", m)
+	}
+}
+
+func TestCheck_implicitCast(t *testing.T) {
+	explain := parseFileWithOptions(t, "explain14.txt", Options{EnableChecks: []string{"implicit-cast"}})
+
+	warnings := explain.AllWarnings()
+	if len(warnings) != 9 {
+		t.Fatalf("Expected 9 warnings, got %v", warnings)
+	}
+
+	// Linked to the motion, with the join it feeds
+	w := warnings[0]
+	if w.Node == nil || w.Node.MotionType != "Redistribute" || w.LineStart != 27 {
+		t.Errorf("Expected the warning on the Redistribute Motion, got %+v", w)
+	}
+	if !reflect.DeepEqual(w.Params["hash_keys"], []string{"o.insertion_order_id::integer", "ac.campaign_sc::text"}) || w.Params["join_node"] != w.Node.Parent.ID {
+		t.Errorf("Unexpected params %v", w.Params)
+	}
+
+	// Text casts which caused a motion
+	w = warnings[1]
+	if w.LineStart != 45 || w.Cause != "Redistribute Motion on d1.date_dt::text caused by the cast in d1.date_dt::text = o.start_dt::text" {
+		t.Errorf("Unexpected text cast warning %+v", w)
+	}
+	w = warnings[7]
+	if w.LineStart != 112 || !reflect.DeepEqual(w.Params["hash_keys"], []string{"d.brief_code::integer", "d.adserver_campaign_id::text"}) {
+		t.Errorf("Unexpected text cast warning %+v", w)
+	}
+
+	// d.brief_code::integer = t.brief_code::integer without a motion
+	w = warnings[8]
+	if w.Node == nil || w.Node.HashCond == "" || w.Cause != "Join casts d.brief_code to integer, t.brief_code to integer: d.brief_code::integer = t.brief_code::integer" {
+		t.Errorf("Unexpected join warning %+v", w)
+	}
+}
+
+// Text casts on both sides without a motion may be varchar columns
+func TestCheck_implicitCastText(t *testing.T) {
+	explain := parseFileWithOptions(t, "explain15.txt", Options{EnableChecks: []string{"implicit-cast"}})
+
+	found := false
+	for _, w := range explain.AllWarnings() {
+		if w.Cause == "Join casts imp.buy_id to text, cmpgn.source_cd to text: imp.buy_id::text = cmpgn.source_cd::text" {
+			found = true
+			if w.Severity != SeverityInfo {
+				t.Errorf("Expected info severity, got %s", w.Severity)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected the text cast in the join to be reported")
+	}
+}
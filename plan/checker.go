@@ -2,218 +2,589 @@ package plan
 
 import (
 	"fmt"
-	"regexp"
+	"math"
+	"strings"
 )
 
 type NodeCheck struct {
+	ID          string // Used to enable or disable the check, never changes once released
 	Name        string
 	Description string
+	Severity    string // info, warning, critical
+	Category    string // statistics, joins, memory etc...
 	CreatedAt   string
-	Scope       []string
+	Scope       []string // Optimizers the check applies to, orca and/or legacy
 	Exec        func(*Node)
 }
 
 type ExplainCheck struct {
+	ID          string
 	Name        string
 	Description string
+	Severity    string
+	Category    string
 	CreatedAt   string
 	Scope       []string
 	Exec        func(*Explain)
 }
 
-// Keep all checks in NODECHEKS and EXPLAINCHECKS so that we can
-// dynamically create a list of checks to display in webapp
+// The built in checks. They are registered in DefaultRegistry so they
+// can be listed, enabled or disabled, see registry.go
 
 // ------------------------------------------------------------
 // Checks relating to each node
 // ------------------------------------------------------------
-var NODECHECKS = []NodeCheck{
+var nodeChecks = []NodeCheck{
 	NodeCheck{
+		"estimated-rows",
 		"checkNodeEstimatedRows",
 		"Scan node with estimated rows equal to 1",
+		SeverityWarning,
+		"statistics",
 		"2016-05-24",
 		[]string{"orca", "legacy"},
 		func(n *Node) {
-			re := regexp.MustCompile(`(Dynamic Table|Table|Parquet table|Bitmap Index|Bitmap Append-Only Row-Oriented|Seq) Scan`)
-			if re.MatchString(n.Operator) {
-				if n.Rows == 1 {
-					warningAction := ""
-					// Preformat the string here
-					if n.ObjectType == "TABLE" {
-						warningAction = fmt.Sprintf("ANALYZE on table")
-					} else if n.ObjectType == "INDEX" {
-						warningAction = fmt.Sprintf("REINDEX on index")
-					}
+			if n.estimatedOneRow() {
+				warningAction := ""
+				// Preformat the string here
+				if n.ObjectType == "TABLE" {
+					warningAction = fmt.Sprintf("ANALYZE on table")
+				} else if n.ObjectType == "INDEX" {
+					warningAction = fmt.Sprintf("REINDEX on index")
+				}
 
-					// If EXPLAIN ANALYZE output then have to check further
-					if n.IsAnalyzed == true {
-						if n.ActualRows > 1 || n.AvgRows > 1 {
-							n.Warnings = append(n.Warnings, Warning{
-								"Actual rows is higher than estimated rows",
-								fmt.Sprintf("Need to run %s \"%s\"", warningAction, n.Object)})
-						}
-						// Else just flag as a potential not analyzed table
-					} else {
-						n.Warnings = append(n.Warnings, Warning{
-							"Estimated rows is 1",
-							fmt.Sprintf("May need to run %s \"%s\"", warningAction, n.Object)})
-					}
+				// If EXPLAIN ANALYZE output then more rows were found
+				if n.IsAnalyzed == true {
+					n.Warnings = append(n.Warnings, Warning{
+						Cause:      "Actual rows is higher than estimated rows",
+						Resolution: fmt.Sprintf("Need to run %s \"%s\"", warningAction, n.Object),
+						Params:     WarningParams{"estimated": n.Rows, "measured": n.ActualRows.Or(n.AvgRows.Value)}})
+					// Else just flag as a potential not analyzed table
+				} else {
+					n.Warnings = append(n.Warnings, Warning{
+						Cause:      "Estimated rows is 1",
+						Resolution: fmt.Sprintf("May need to run %s \"%s\"", warningAction, n.Object),
+						Params:     WarningParams{"estimated": n.Rows}})
 				}
 			}
 		}},
 	NodeCheck{
-		"checkNodeNestedLoop",
-		"Nested Loops",
-		"2016-05-23",
+		"row-misestimate",
+		"checkNodeRowMisestimate",
+		"Actual rows far higher or lower than estimated",
+		SeverityWarning,
+		"statistics",
+		"2026-10-16",
 		[]string{"orca", "legacy"},
+		// Example, 500 times more rows than estimated:
+		//     ->  Seq Scan on sales  (cost=0.00..431.00 rows=100 width=8)
+		//           Rows out:  Avg 50000.0 rows x 4 workers.  Max 50010 rows (seg2) ...
+		//
 		func(n *Node) {
-			re := regexp.MustCompile(`Nested Loop`)
-			if re.MatchString(n.Operator) {
-				n.Warnings = append(n.Warnings, Warning{
-					"Nested Loop",
-					"Review query"})
+			thresholds := n.Thresholds()
+			if !n.isLowestMisestimate(thresholds) {
+				return
+			}
+
+			_, under := n.misestimate(thresholds)
+			estimated, actual, _ := n.RowEstimate()
+			direction := "fewer"
+			if under {
+				direction = "more"
+			}
+			resolution := "Run ANALYZE on the tables below this node and check the conditions for correlated columns"
+			tables := n.SourceTables()
+			if len(tables) > 0 {
+				resolution = fmt.Sprintf("Run ANALYZE on %s and check the conditions for correlated columns", strings.Join(tables, ", "))
+			}
+
+			n.Warnings = append(n.Warnings, Warning{
+				Cause:      fmt.Sprintf("Estimated %.0f rows but %.0f were produced, %.0f times %s than estimated", estimated, actual, n.QError().Value, direction),
+				Resolution: resolution,
+				Params: WarningParams{"estimated": estimated, "actual": actual, "q_error": n.QError().Value, "direction": direction,
+					"tables": tables, "threshold": thresholds.MisestimateRatio}})
+		}},
+	NodeCheck{
+		"hash-build-side",
+		"checkNodeHashBuildSide",
+		"Hash Join hashing the larger input",
+		SeverityWarning,
+		"joins",
+		"2026-10-16",
+		[]string{"orca", "legacy"},
+		func(n *Node) {
+			outer, inner := n.JoinInputs()
+			if outer == nil || !joinPatterns["HASH_JOIN"].MatchString(n.Operator) {
+				return
+			}
+			thresholds := n.Thresholds()
+			probe, _ := outer.RowsPerProcess()
+			build, analyzed := inner.RowsPerProcess()
+			if build < thresholds.JoinInputRows || build < probe*thresholds.HashBuildRatio {
+				return
+			}
+
+			// The optimizer hashes the input it thinks is smaller
+			resolution := "Check whether an outer join forces this input to be hashed, the hash table uses more memory and may spill"
+			if m, under := inner.misestimate(thresholds); m && under && len(inner.SourceTables()) > 0 {
+				resolution = fmt.Sprintf("Run ANALYZE on %s so the optimizer hashes the smaller input", strings.Join(inner.SourceTables(), ", "))
+			}
+
+			n.Warnings = append(n.Warnings, Warning{
+				Cause:      fmt.Sprintf("Hash Join builds the hash table from %.0f rows and probes it with %.0f rows per segment", build, probe),
+				Resolution: resolution,
+				Params: WarningParams{"build_rows": build, "probe_rows": probe, "analyzed": analyzed,
+					"threshold_ratio": thresholds.HashBuildRatio, "threshold_rows": thresholds.JoinInputRows}})
+		}},
+	NodeCheck{
+		"large-join-inputs",
+		"checkNodeLargeJoinInputs",
+		"Merge Join or Nested Loop with large inputs",
+		SeverityWarning,
+		"joins",
+		"2026-10-16",
+		[]string{"orca", "legacy"},
+		func(n *Node) {
+			outer, inner := n.JoinInputs()
+			if outer == nil {
+				return
 			}
+			thresholds := n.Thresholds()
+			outerRows, analyzed := outer.RowsPerProcess()
+			innerRows, _ := inner.RowsPerProcess()
+			if outerRows < thresholds.JoinInputRows || innerRows < thresholds.JoinInputRows {
+				return
+			}
+
+			var cause, resolution string
+			switch {
+			case patterns["NESTED_LOOP"].MatchString(n.Operator):
+				// Reported by cartesian-product instead, this covers the
+				// ones with fewer than CartesianRows comparisons
+				if n.isCartesianProduct(thresholds) {
+					return
+				}
+				cause = fmt.Sprintf("Nested Loop compares %.0f inner rows with each of %.0f outer rows per segment", innerRows, outerRows)
+				if inner.isParameterizedBy(outer) {
+					cause = fmt.Sprintf("Nested Loop looks up %.0f inner rows for each of %.0f outer rows per segment", innerRows, outerRows)
+				}
+				resolution = "Use an equality join condition a Hash Join can use and check enable_nestloop is off"
+			case joinPatterns["MERGE_JOIN"].MatchString(n.Operator):
+				cause = fmt.Sprintf("Merge Join sorts %.0f and %.0f rows per segment", outerRows, innerRows)
+				resolution = "Check enable_mergejoin is off and enable_hashjoin is on, a Hash Join does not need sorted inputs"
+			default:
+				return
+			}
+
+			n.Warnings = append(n.Warnings, Warning{
+				Cause:      cause,
+				Resolution: resolution,
+				Params:     WarningParams{"outer_rows": outerRows, "inner_rows": innerRows, "analyzed": analyzed, "threshold": thresholds.JoinInputRows}})
+		}},
+	NodeCheck{
+		"cartesian-product",
+		"checkNodeCartesianProduct",
+		"Nested Loop without a join condition",
+		SeverityCritical,
+		"joins",
+		"2026-10-16",
+		[]string{"orca", "legacy"},
+		// Example:
+		//     Nested Loop
+		//       Join Filter: a13.master_account_sk = a14.account_sk
+		//       ->  ...
+		func(n *Node) {
+			thresholds := n.Thresholds()
+			if !n.isCartesianProduct(thresholds) {
+				return
+			}
+			outer, inner := n.JoinInputs()
+			outerRows, analyzed := outer.RowsPerProcess()
+			innerRows, _ := inner.RowsPerProcess()
+
+			cause := fmt.Sprintf("Cartesian product of %.0f and %.0f rows per segment", outerRows, innerRows)
+			resolution := "Add the missing join condition"
+			if n.JoinFilter != "" {
+				cause += " filtered by a Join Filter"
+				resolution = "Rewrite the Join Filter as an equality between columns of the same type so a Hash Join can be used"
+			}
+
+			n.Warnings = append(n.Warnings, Warning{
+				Cause:      cause,
+				Resolution: resolution,
+				Params: WarningParams{"outer_rows": outerRows, "inner_rows": innerRows, "join_filter": n.JoinFilter, "analyzed": analyzed,
+					"threshold": thresholds.CartesianRows}})
 		}},
 	NodeCheck{
+		"spilling",
 		"checkNodeSpilling",
 		"Spill files",
+		SeverityWarning,
+		"memory",
 		"2016-05-31",
 		[]string{"orca", "legacy"},
 		func(n *Node) {
-			if n.SpillFile >= 1 {
+			if n.SpillFile.Or(0) >= 1 {
 				n.Warnings = append(n.Warnings, Warning{
-					fmt.Sprintf("Total %d spilling segments found", n.SpillFile),
-					"Review query"})
+					Cause:      fmt.Sprintf("Total %d spilling segments found", n.SpillFile),
+					Resolution: "Review query",
+					Params:     WarningParams{"measured": n.SpillFile.Value, "threshold": 1}})
 			}
 		}},
 	NodeCheck{
+		"work-mem-wanted",
+		"checkNodeWorkMemWanted",
+		"Work_mem wanted is higher than work_mem used",
+		SeverityWarning,
+		"memory",
+		"2026-10-16",
+		[]string{"orca", "legacy"},
+		// Example:
+		//     Work_mem used:  488K bytes avg, 491K bytes max (seg0). Workfile: (2 spilling, 0 reused)
+		//     Work_mem wanted: 8210K bytes avg, 9723K bytes max (seg0) to lessen workfile I/O affecting 2 workers.
+		//
+		func(n *Node) {
+			if n.WorkMemWantedMax.Or(0) > 0 && n.WorkMemWantedMax.Value > n.MaxMem.Or(0) {
+				// Nothing used if the node did not report any memory
+				shortfall := n.WorkMemWantedMax.Value - n.MaxMem.Or(0)
+				n.Warnings = append(n.Warnings, Warning{
+					Cause: fmt.Sprintf("Work_mem wanted %.0fK bytes on %s but only %.0fK bytes used, %.0fK bytes short affecting %d workers",
+						n.WorkMemWantedMax, n.WorkMemWantedSeg, n.MaxMem, shortfall, n.WorkMemWantedWorkers),
+					Resolution: fmt.Sprintf("Increase statement_mem by at least %.0fMB to avoid workfile I/O", math.Ceil(shortfall/1024)),
+					Params:     WarningParams{"wanted": n.WorkMemWantedMax.Value, "used": n.MaxMem.Or(0), "shortfall": shortfall, "unit": "KB"}})
+			}
+		}},
+	NodeCheck{
+		"hash-chain",
+		"checkNodeHashChain",
+		"Hash table with long chains or low bucket usage",
+		SeverityWarning,
+		"joins",
+		"2026-10-16",
+		[]string{"orca", "legacy"},
+		// Example:
+		//     Hash Cond: t1.a = t2.b
+		//     (seg1)   Hash chain length 1111.0 avg, 2000 max, using 3 of 1048589 buckets.
+		//
+		func(n *Node) {
+			chainMaxThreshold := n.Thresholds().HashChainMax
+			chainAvgThreshold := n.Thresholds().HashChainAvg
+			bucketPrctThreshold := n.Thresholds().HashBucketPrct
+
+			if n.HashBuckets.Or(0) <= 0 {
+				return
+			}
+
+			bucketPrct := float64(n.HashBucketsUsed.Or(0)) * 100 / float64(n.HashBuckets.Value)
+
+			if float64(n.HashChainMax.Or(0)) >= chainMaxThreshold || (n.HashChainAvg.Or(0) >= chainAvgThreshold && bucketPrct < bucketPrctThreshold) {
+				keys := "the join keys"
+				if n.HashCond != "" {
+					keys = fmt.Sprintf("join keys %s", exprColumnsString(n.HashCond))
+				}
+				n.Warnings = append(n.Warnings, Warning{
+					Cause: fmt.Sprintf("Hash chain length %.1f avg, %d max using %d of %d buckets (%.2f%%) on %s",
+						n.HashChainAvg, n.HashChainMax, n.HashBucketsUsed, n.HashBuckets, bucketPrct, n.HashSeg),
+					Resolution: fmt.Sprintf("Check %s for skewed or low cardinality values", keys),
+					Params: WarningParams{"chain_max": n.HashChainMax.Or(0), "chain_avg": n.HashChainAvg.Or(0), "bucket_prct": bucketPrct,
+						"chain_max_threshold": chainMaxThreshold, "chain_avg_threshold": chainAvgThreshold, "bucket_prct_threshold": bucketPrctThreshold}})
+			}
+		}},
+	NodeCheck{
+		"scans",
 		"checkNodeScans",
 		"Node looping multiple times",
+		SeverityInfo,
+		"execution",
 		"2016-05-31",
 		[]string{"orca", "legacy"},
 		func(n *Node) {
-			if n.Scans > 1 {
+			if n.Scans.Or(0) > 1 {
 				n.Warnings = append(n.Warnings, Warning{
-					fmt.Sprintf("This node is executed %d times", n.Scans),
-					"Review query"})
+					Cause:      fmt.Sprintf("This node is executed %d times", n.Scans),
+					Resolution: "Review query",
+					Params:     WarningParams{"measured": n.Scans.Value, "threshold": 1}})
 			}
 		}},
 	NodeCheck{
+		"partition-scans",
 		"checkNodePartitionScans",
 		"Number of partition scans greater than 100 or 25%%",
+		SeverityWarning,
+		"partitions",
 		"2016-05-31",
 		[]string{"orca", "legacy"},
 		func(n *Node) {
-			partitionThreshold := int64(100)
-			partitionPrctThreshold := int64(25)
+			partitionThreshold := n.Thresholds().PartitionScans
+			partitionPrctThreshold := n.Thresholds().PartitionPrct
 
 			// Planner
-			re := regexp.MustCompile(`Append`)
+			re := patterns["APPEND"]
 			if re.MatchString(n.Operator) {
 				// Warn if the Append node has more than 100 subnodes
-				if int64(len(n.SubNodes)) >= partitionThreshold {
+				if float64(len(n.SubNodes)) >= partitionThreshold {
 					n.Warnings = append(n.Warnings, Warning{
-						fmt.Sprintf("Detected %d partition scans", len(n.SubNodes)),
-						"Check if partitions can be eliminated"})
+						Cause:      fmt.Sprintf("Detected %d partition scans", len(n.SubNodes)),
+						Resolution: "Check if partitions can be eliminated",
+						Params:     WarningParams{"measured": len(n.SubNodes), "threshold": partitionThreshold}})
 				}
 			}
 
 			// ORCA
 
 			// SELECTED
-			re = regexp.MustCompile(`Partition Selector`)
-			if re.MatchString(n.Operator) && n.PartSelected > -1 {
+			re = patterns["PARTITION_SELECTOR"]
+			if re.MatchString(n.Operator) && n.PartSelected.Valid {
 				// Warn if selected partitions is great than 100
-				if n.PartSelected >= partitionThreshold {
+				if float64(n.PartSelected.Value) >= partitionThreshold {
 					n.Warnings = append(n.Warnings, Warning{
-						fmt.Sprintf("Detected %d partition scans", n.PartSelected),
-						"Check if partitions can be eliminated"})
+						Cause:      fmt.Sprintf("Detected %d partition scans", n.PartSelected),
+						Resolution: "Check if partitions can be eliminated",
+						Params:     WarningParams{"measured": n.PartSelected.Value, "threshold": partitionThreshold}})
 				}
 
 				// Warn if selected partitons is 0, may be an issue
-				if n.PartSelected == 0 {
+				if n.PartSelected.Value == 0 {
 					n.Warnings = append(n.Warnings, Warning{
-						"Zero partitions selected",
-						"Review query"})
-					// Also warn if greater than 25% of total partitions were selected.
-					// I just chose 25% for now... may need to be adjusted to a more reasonable value
-				} else if (n.PartSelected * 100 / n.PartSelectedTotal) >= partitionPrctThreshold {
+						Cause:      "Zero partitions selected",
+						Resolution: "Review query",
+						Params:     WarningParams{"measured": 0}})
+					// Also warn if greater than 25% of total partitions were selected
+				} else if n.PartSelectedTotal.Or(0) > 0 && float64(n.PartSelected.Value*100/n.PartSelectedTotal.Value) >= partitionPrctThreshold {
 					n.Warnings = append(n.Warnings, Warning{
-						fmt.Sprintf("%d%% (%d out of %d) partitions selected", (n.PartSelected * 100 / n.PartSelectedTotal), n.PartSelected, n.PartSelectedTotal),
-						"Check if partitions can be eliminated"})
+						Cause:      fmt.Sprintf("%d%% (%d out of %d) partitions selected", (n.PartSelected.Value * 100 / n.PartSelectedTotal.Value), n.PartSelected, n.PartSelectedTotal),
+						Resolution: "Check if partitions can be eliminated",
+						Params:     WarningParams{"measured": n.PartSelected.Value, "total": n.PartSelectedTotal.Value, "threshold_prct": partitionPrctThreshold}})
 				}
 			}
 
 			// SCANNED
-			re = regexp.MustCompile(`Dynamic Table Scan`)
-			if re.MatchString(n.Operator) && n.PartScanned > -1 {
+			re = patterns["DYNAMIC_TABLE_SCAN"]
+			if re.MatchString(n.Operator) && n.PartScanned.Valid {
 				// Warn if scanned partitions is great than 100
-				if n.PartScanned >= partitionThreshold {
+				if float64(n.PartScanned.Value) >= partitionThreshold {
 					n.Warnings = append(n.Warnings, Warning{
-						fmt.Sprintf("Detected %d partition scans", n.PartScanned),
-						"Check if partitions can be eliminated"})
+						Cause:      fmt.Sprintf("Detected %d partition scans", n.PartScanned),
+						Resolution: "Check if partitions can be eliminated",
+						Params:     WarningParams{"measured": n.PartScanned.Value, "threshold": partitionThreshold}})
 				}
 
 				// Warn if scanned partitons is 0, may be an issue
-				if n.PartScanned == 0 {
+				if n.PartScanned.Value == 0 {
 					n.Warnings = append(n.Warnings, Warning{
-						"Zero partitions scanned",
-						"Review query"})
-					// Also warn if greater than 25% of total partitions were scanned.
-					// I just chose 25% for now... may need to be adjusted to a more reasonable value
-				} else if (n.PartScanned * 100 / n.PartScannedTotal) >= partitionPrctThreshold {
+						Cause:      "Zero partitions scanned",
+						Resolution: "Review query",
+						Params:     WarningParams{"measured": 0}})
+					// Also warn if greater than 25% of total partitions were scanned
+				} else if n.PartScannedTotal.Or(0) > 0 && float64(n.PartScanned.Value*100/n.PartScannedTotal.Value) >= partitionPrctThreshold {
 					n.Warnings = append(n.Warnings, Warning{
-						fmt.Sprintf("%d%% (%d out of %d) partitions scanned", (n.PartScanned * 100 / n.PartScannedTotal), n.PartScanned, n.PartScannedTotal),
-						"Check if partitions can be eliminated"})
+						Cause:      fmt.Sprintf("%d%% (%d out of %d) partitions scanned", (n.PartScanned.Value * 100 / n.PartScannedTotal.Value), n.PartScanned, n.PartScannedTotal),
+						Resolution: "Check if partitions can be eliminated",
+						Params:     WarningParams{"measured": n.PartScanned.Value, "total": n.PartScannedTotal.Value, "threshold_prct": partitionPrctThreshold}})
 				}
 			}
 		}},
 	NodeCheck{
+		"data-skew",
 		"checkNodeDataSkew",
 		"Data skew",
+		SeverityCritical,
+		"distribution",
 		"2016-06-02",
 		[]string{"orca", "legacy"},
 		func(n *Node) {
-			threshold := 10000.0
+			threshold := n.Thresholds().DataSkewRows
 
 			// Only proceed if over threshold
-			if n.ActualRows >= threshold || n.AvgRows >= threshold {
+			if n.ActualRows.Or(0) >= threshold || n.AvgRows.Or(0) >= threshold {
 				// Handle AvgRows
-				if n.AvgRows > 0 {
+				if n.AvgRows.Or(0) > 0 {
 					// A segment has more than 50% of all rows
 					// Only do this if workers > 2 otherwise this situation will report skew:
 					//     Rows out:  Avg 500000.0 rows x 2 workers.  Max 500001 rows (seg0)
 					// but seg0 only has 1 extra row
-					if (n.MaxRows > (n.AvgRows * float64(n.Workers) / 2.0)) && n.Workers > 2 {
+					if n.MaxRows.Or(0) > (n.AvgRows.Value*float64(n.Workers.Or(0))/2.0) && n.Workers.Or(0) > 2 {
 						n.Warnings = append(n.Warnings, Warning{
-							fmt.Sprintf("Data skew on segment %s", n.MaxSeg),
-							"Review query"})
+							Cause:      fmt.Sprintf("Data skew on segment %s", n.MaxSeg),
+							Resolution: "Review query",
+							Params:     WarningParams{"segment": n.MaxSeg.Value, "max_rows": n.MaxRows.Value, "avg_rows": n.AvgRows.Value, "workers": n.Workers.Value, "threshold": threshold}})
 					}
 					// Handle ActualRows
 					// If ActualRows is set and MaxSeg is set then this
 					// segment has the highest rows
-				} else if n.ActualRows > 0 && n.MaxSeg != "-" {
+				} else if n.ActualRows.Or(0) > 0 && n.MaxSeg.Valid {
 					n.Warnings = append(n.Warnings, Warning{
-						fmt.Sprintf("Data skew on segment %s", n.MaxSeg),
-						"Review query"})
+						Cause:      fmt.Sprintf("Data skew on segment %s", n.MaxSeg),
+						Resolution: "Review query",
+						Params:     WarningParams{"segment": n.MaxSeg.Value, "measured": n.ActualRows.Value, "threshold": threshold}})
 				}
 			}
 		}},
 	NodeCheck{
+		"filter-function",
 		"checkNodeFilterWithFunction",
 		"Filter clause using function",
+		SeverityInfo,
+		"predicates",
 		"2016-06-06",
 		[]string{"orca", "legacy"},
 		// Example:
 		//     upper(brief_status::text) = ANY ('{SIGNED,BRIEF,PROPO}'::text[])
 		//
 		func(n *Node) {
-			re := regexp.MustCompile(`\S+\(.*\) `)
+			re := patterns["FUNCTION_CALL"]
 
 			if re.MatchString(n.Filter) {
 				n.Warnings = append(n.Warnings, Warning{
-					"Filter using function",
-					"Check if function can be avoided"})
+					Cause:      "Filter using function",
+					Resolution: "Check if function can be avoided"})
+			}
+		}},
+	NodeCheck{
+		"broadcast-volume",
+		"checkNodeBroadcastVolume",
+		"Broadcast Motion sending a lot of data to every segment",
+		SeverityWarning,
+		"motions",
+		"2026-10-16",
+		[]string{"orca", "legacy"},
+		func(n *Node) {
+			bytes, ok := n.BroadcastBytes()
+			if !ok {
+				return
+			}
+			thresholds := n.Thresholds()
+			mb := bytes / 1024 / 1024
+			if mb < thresholds.BroadcastMB {
+				return
+			}
+
+			child := n.Children()[0]
+			rows, analyzed := child.TotalRows()
+			measured := "estimated"
+			if analyzed {
+				measured = "sent"
+			}
+
+			// The optimizer only broadcasts a big relation when it thinks it
+			// is small, so stale statistics are the first thing to fix
+			resolution := "Redistribute on the join key instead, e.g. distribute the tables on the join columns, or filter the rows before the join"
+			if m, under := child.misestimate(thresholds); m && under && len(child.SourceTables()) > 0 {
+				resolution = fmt.Sprintf("Run ANALYZE on %s, the optimizer estimated %.0f rows", strings.Join(child.SourceTables(), ", "), float64(child.Rows)*float64(child.Processes()))
+			}
+
+			severity := ""
+			if mb >= thresholds.BroadcastCriticalMB {
+				severity = SeverityCritical
+			}
+
+			n.Warnings = append(n.Warnings, Warning{
+				Cause:      fmt.Sprintf("Broadcast of %.0f rows x %d bytes to %d segments, %.0fMB %s", rows, child.Width, n.Receivers, mb, measured),
+				Resolution: resolution,
+				Severity:   severity,
+				Params: WarningParams{"rows": rows, "width": child.Width, "segments": n.Receivers.Value, "mb": mb, "analyzed": analyzed,
+					"threshold": thresholds.BroadcastMB, "critical": thresholds.BroadcastCriticalMB}})
+		}},
+	NodeCheck{
+		"implicit-cast",
+		"checkNodeImplicitCast",
+		"Join condition or filter casting a column to another type",
+		SeverityWarning,
+		"distribution",
+		"2026-10-16",
+		[]string{"orca", "legacy"},
+		// Example:
+		//     Hash Join
+		//       Hash Cond: o.insertion_order_id::integer = d.brief_code::integer
+		//       ->  Redistribute Motion 320:320  (slice11; segments: 320)
+		//             Hash Key: o.insertion_order_id::integer
+		func(n *Node) {
+			describe := func(mismatches []castMismatch) ([]string, []string, []string) {
+				conditions := []string{}
+				columns := []string{}
+				casts := []string{}
+				for _, m := range mismatches {
+					conditions = append(conditions, m.Condition)
+					for _, c := range m.Columns {
+						if !containsString(columns, c) {
+							columns = append(columns, c)
+						}
+					}
+					for _, c := range m.Casts {
+						casts = append(casts, fmt.Sprintf("%s to %s", c.Column, c.Type))
+					}
+				}
+				return conditions, columns, casts
+			}
+
+			// The rows are redistributed on the cast value so the table
+			// distribution can not be used for the join
+			if join := n.inputJoin(); join != nil && n.MotionType == "Redistribute" {
+				keys, caused := n.redistributedCasts(join.joinCastMismatches())
+				if len(keys) == 0 {
+					return
+				}
+				conditions, columns, _ := describe(caused)
+				hashKeys := []string{}
+				for _, k := range keys {
+					hashKeys = append(hashKeys, k.String())
+				}
+				n.Warnings = append(n.Warnings, Warning{
+					Cause:      fmt.Sprintf("Redistribute Motion on %s caused by the cast in %s", strings.Join(hashKeys, ", "), strings.Join(conditions, " AND ")),
+					Resolution: fmt.Sprintf("Use the same data type for %s so the tables can be distributed on them", strings.Join(columns, ", ")),
+					Params:     WarningParams{"hash_keys": hashKeys, "columns": columns, "join_node": join.ID}})
+				return
+			}
+
+			// Casts which did not cause a motion below the join
+			uncaused := []castMismatch{}
+			for _, m := range n.joinCastMismatches() {
+				caused := false
+				n.Walk(func(s *Node) bool {
+					if s != n && s.inputJoin() == n {
+						if _, c := s.redistributedCasts([]castMismatch{m}); len(c) > 0 {
+							caused = true
+						}
+					}
+					return s == n || (!s.IsJoin() && s.MotionType == "")
+				})
+				if !caused {
+					uncaused = append(uncaused, m)
+				}
+			}
+			if len(uncaused) > 0 {
+				conditions, columns, casts := describe(uncaused)
+				w := Warning{
+					Cause:      fmt.Sprintf("Join casts %s: %s", strings.Join(casts, ", "), strings.Join(conditions, " AND ")),
+					Resolution: fmt.Sprintf("Use the same data type for %s", strings.Join(columns, ", ")),
+					Params:     WarningParams{"casts": casts, "columns": columns}}
+				// Text casts of varchar columns cost little without a motion
+				text := true
+				for _, m := range uncaused {
+					text = text && m.Text
+				}
+				if text {
+					w.Severity = SeverityInfo
+				}
+				n.Warnings = append(n.Warnings, w)
+			}
+
+			// Filters can not use the column statistics, indexes or
+			// partitions of a cast column. Comparing a varchar column
+			// with a text value shows the same casts so they are left out
+			mismatches := []castMismatch{}
+			for _, m := range castMismatches(n.Filter) {
+				if !m.Text {
+					mismatches = append(mismatches, m)
+				}
+			}
+			if len(mismatches) > 0 {
+				conditions, columns, casts := describe(mismatches)
+				n.Warnings = append(n.Warnings, Warning{
+					Cause:      fmt.Sprintf("Filter casts %s: %s", strings.Join(casts, ", "), strings.Join(conditions, " AND ")),
+					Resolution: fmt.Sprintf("Compare %s with a value of the same type", strings.Join(columns, ", ")),
+					Severity:   SeverityInfo,
+					Params:     WarningParams{"casts": casts, "columns": columns}})
 			}
 		}},
 }
@@ -221,75 +592,86 @@ var NODECHECKS = []NodeCheck{
 // ------------------------------------------------------------
 // Checks relating to the over all Explain output
 // ------------------------------------------------------------
-var EXPLAINCHECKS = []ExplainCheck{
+var explainChecks = []ExplainCheck{
 	ExplainCheck{
+		"motion-count",
 		"checkExplainMotionCount",
 		"Number of Broadcast/Redistribute Motion nodes greater than 5",
+		SeverityWarning,
+		"motions",
 		"2016-05-23",
 		[]string{"orca", "legacy"},
 		func(e *Explain) {
 			motionCount := 0
-			motionCountLimit := 5
-
-			re := regexp.MustCompile(`(Broadcast|Redistribute) Motion`)
+			motionCountLimit := e.Thresholds.MotionCount
 
 			for _, n := range e.Nodes {
-				if re.MatchString(n.Operator) {
+				if matchPattern("MOTION_DATA", n.Operator) {
 					motionCount++
 				}
 			}
 
-			if motionCount >= motionCountLimit {
+			if float64(motionCount) >= motionCountLimit {
 				e.Warnings = append(e.Warnings, Warning{
-					fmt.Sprintf("Found %d Redistribute/Broadcast motions", motionCount),
-					"Review query"})
+					Cause:      fmt.Sprintf("Found %d Redistribute/Broadcast motions", motionCount),
+					Resolution: "Review query",
+					Params:     WarningParams{"measured": motionCount, "threshold": motionCountLimit}})
 			}
 		}},
 	ExplainCheck{
+		"slice-count",
 		"checkExplainSliceCount",
 		"Number of slices greater than 100",
+		SeverityWarning,
+		"motions",
 		"2016-05-31",
 		[]string{"orca", "legacy"},
 		func(e *Explain) {
 			sliceCount := 0
-			sliceCountLimit := 100
+			sliceCountLimit := e.Thresholds.SliceCount
 
 			for _, n := range e.Nodes {
-				if n.Slice > -1 {
+				if n.Slice.Valid {
 					sliceCount++
 				}
 			}
 
-			if sliceCount > sliceCountLimit {
+			if float64(sliceCount) > sliceCountLimit {
 				e.Warnings = append(e.Warnings, Warning{
-					fmt.Sprintf("Found %d slices", sliceCount),
-					"Review query"})
+					Cause:      fmt.Sprintf("Found %d slices", sliceCount),
+					Resolution: "Review query",
+					Params:     WarningParams{"measured": sliceCount, "threshold": sliceCountLimit}})
 			}
 		}},
 	ExplainCheck{
+		"planner-fallback",
 		"checkExplainPlannerFallback",
 		"ORCA fallback to legacy query planner",
+		SeverityInfo,
+		"optimizer",
 		"2016-05-31",
 		[]string{"orca"},
 		func(e *Explain) {
 			// Settings:  optimizer=on
 			// Optimizer status: legacy query optimizer
-			re := regexp.MustCompile(`legacy query optimizer`)
-
-			if re.MatchString(e.OptimizerStatus) {
+			// Optimizer: Postgres query optimizer
+			if patterns["OPTIMIZER_LEGACY"].MatchString(e.OptimizerStatus) {
 				for _, s := range e.Settings {
 					if s.Name == "optimizer" && s.Value == "on" {
 						e.Warnings = append(e.Warnings, Warning{
-							"ORCA enabled but plan was produced by legacy query optimizer",
-							"No Action Required"})
+							Cause:      "ORCA enabled but plan was produced by legacy query optimizer",
+							Resolution: "No Action Required"})
 						break
 					}
 				}
 			}
 		}},
 	ExplainCheck{
+		"enable-guc",
 		"checkExplainEnableGucNonDefault",
 		"\"enable_\" GUCs configured with non-default values",
+		SeverityWarning,
+		"settings",
 		"2016-06-06",
 		[]string{"orca", "legacy"},
 		func(e *Explain) {
@@ -309,7 +691,7 @@ var EXPLAINCHECKS = []ExplainCheck{
 			}
 
 			// Settings:  enable_hashjoin=off; enable_indexscan=off; join_collapse_limit=1; optimizer=on
-			re := regexp.MustCompile(`enable_`)
+			re := patterns["SETTING_ENABLE"]
 
 			for _, s := range e.Settings {
 				if re.MatchString(s.Name) {
@@ -317,16 +699,20 @@ var EXPLAINCHECKS = []ExplainCheck{
 						// Only report if NOT default value
 						if s.Value != value {
 							e.Warnings = append(e.Warnings, Warning{
-								fmt.Sprintf("\"%s\" GUC has non-default value \"%s\"", s.Name, s.Value),
-								fmt.Sprintf("Check if \"%s\" GUC is required", s.Name)})
+								Cause:      fmt.Sprintf("\"%s\" GUC has non-default value \"%s\"", s.Name, s.Value),
+								Resolution: fmt.Sprintf("Check if \"%s\" GUC is required", s.Name),
+								Params:     WarningParams{"setting": s.Name, "measured": s.Value, "default": value}})
 						}
 					}
 				}
 			}
 		}},
 	ExplainCheck{
+		"child-partition-scan",
 		"checkExplainOrcaChildPartitionScan",
 		"Scan on child partition instead of root partition",
+		SeverityWarning,
+		"partitions",
 		"2016-06-08",
 		[]string{"orca"},
 		func(e *Explain) {
@@ -338,15 +724,65 @@ var EXPLAINCHECKS = []ExplainCheck{
 
 			// ->  Seq Scan on sales_1_prt_outlying_years s  (cost=0.00..55276.72 rows=2476236 width=8)
 			// ->  Seq Scan on sales_1_prt_2 s  (cost=0.00..38.44 rows=1722 width=8)
-			re := regexp.MustCompile(`_[0-9]+_prt_`)
-
 			for _, n := range e.Nodes {
 				// Check if object name looks like partition
-				if re.MatchString(n.Operator) {
+				if matchPattern("PARTITION_CHILD", n.Operator) {
 					n.Warnings = append(n.Warnings, Warning{
-						fmt.Sprintf("Scan on what appears to be a child partition"),
-						fmt.Sprintf("Recommend using root partition when ORCA is enabled")})
+						Cause:      fmt.Sprintf("Scan on what appears to be a child partition"),
+						Resolution: fmt.Sprintf("Recommend using root partition when ORCA is enabled")})
 				}
 			}
 		}},
+	ExplainCheck{
+		"slice-work-mem",
+		"checkExplainSliceWorkMem",
+		"Slice wanted more work_mem than was available",
+		SeverityWarning,
+		"memory",
+		"2026-10-16",
+		[]string{"orca", "legacy"},
+		func(e *Explain) {
+			// (slice2)  * Executor memory: 205132K bytes avg x 2 workers, 205136K bytes max (seg0).  Work_mem: 127501K bytes max, 171875K bytes wanted.
+			for _, s := range e.SliceStats {
+				if s.IsConstrained == true && s.WorkMemWanted.Valid && s.WorkMemWanted.Value > s.WorkMem.Or(0) {
+					e.Warnings = append(e.Warnings, Warning{
+						Cause:      fmt.Sprintf("%s wanted %dK bytes work_mem but only used %dK bytes", s.Name, s.WorkMemWanted, s.WorkMem),
+						Resolution: "Increase statement_mem to avoid workfile I/O",
+						Params:     WarningParams{"wanted": s.WorkMemWanted.Value, "used": s.WorkMem.Or(0), "unit": "KB"}})
+				}
+			}
+		}},
+	ExplainCheck{
+		"stale-statistics",
+		"checkExplainStaleStatistics",
+		"Several nodes misestimated rows because of stale table statistics",
+		SeverityWarning,
+		"statistics",
+		"2026-10-16",
+		[]string{"orca", "legacy"},
+		func(e *Explain) {
+			stale := e.StaleStatistics()
+
+			// One node is already covered by its own warning
+			nodes := map[int]bool{}
+			for _, t := range stale {
+				for _, id := range t.NodeIDs {
+					nodes[id] = true
+				}
+			}
+			if len(nodes) < 2 {
+				return
+			}
+
+			tables := []string{}
+			found := []string{}
+			for _, t := range stale {
+				tables = append(tables, t.Table)
+				found = append(found, fmt.Sprintf("%s (nodes %s)", t.Table, joinInts(t.NodeIDs)))
+			}
+			e.Warnings = append(e.Warnings, Warning{
+				Cause:      fmt.Sprintf("%d nodes misestimated rows reading %s", len(nodes), strings.Join(found, ", ")),
+				Resolution: fmt.Sprintf("Run the ANALYZE script for %s", strings.Join(tables, ", ")),
+				Params:     WarningParams{"tables": tables, "nodes": len(nodes)}})
+		}},
 }
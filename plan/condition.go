@@ -0,0 +1,708 @@
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Conditions used by rules, see rules.go
+//     operator =~ "^Seq Scan" && object =~ "^fact_" && rows > 1e8
+//     actual_rows > rows * 10 || settings.enable_nestloop == "on"
+// Fields are the Node or Explain fields, matched ignoring case and "_"
+// so ActualRows and actual_rows are the same. Operator is the whole node
+// text e.g. "Seq Scan on sales" so is usually matched with =~. Node rules
+// can also use the Explain fields with "explain." in front. A comparison
+// with a value which is not in the plan (e.g. actual_rows without
+// ANALYZE) is false
+type condition interface {
+	kind() valueKind
+	eval(env conditionEnv) conditionValue
+}
+
+type valueKind int
+
+const (
+	kindNumber valueKind = iota
+	kindText
+	kindBool
+)
+
+func (k valueKind) String() string {
+	switch k {
+	case kindNumber:
+		return "number"
+	case kindText:
+		return "text"
+	}
+	return "true/false"
+}
+
+// Result of evaluating a condition. Known is false for values which
+// are not in the plan
+type conditionValue struct {
+	Known  bool
+	Number float64
+	Text   string
+	Bool   bool
+}
+
+// Used in Params and warning text
+func (v conditionValue) param(k valueKind) interface{} {
+	switch {
+	case !v.Known:
+		return nil
+	case k == kindNumber:
+		return v.Number
+	case k == kindText:
+		return v.Text
+	}
+	return v.Bool
+}
+
+func (v conditionValue) format(k valueKind) string {
+	switch {
+	case !v.Known:
+		return "-"
+	case k == kindNumber:
+		return strconv.FormatFloat(v.Number, 'f', -1, 64)
+	case k == kindText:
+		return v.Text
+	}
+	return strconv.FormatBool(v.Bool)
+}
+
+// The node is nil for explain rules
+type conditionEnv struct {
+	explain *Explain
+	node    *Node
+}
+
+// ------------------------------------------------------------
+// Fields
+// ------------------------------------------------------------
+
+type fieldCondition struct {
+	name  string
+	k     valueKind
+	value func(env conditionEnv) conditionValue
+}
+
+func (c fieldCondition) kind() valueKind                      { return c.k }
+func (c fieldCondition) eval(env conditionEnv) conditionValue { return c.value(env) }
+
+func normaliseFieldName(name string) string {
+	return strings.ToLower(strings.Replace(name, "_", "", -1))
+}
+
+var (
+	optionalFloatType  = reflect.TypeOf(OptionalFloat{})
+	optionalIntType    = reflect.TypeOf(OptionalInt{})
+	optionalStringType = reflect.TypeOf(OptionalString{})
+)
+
+// Find an exported field of a Node or Explain which a condition can use
+func structField(t reflect.Type, name string) (int, valueKind, bool) {
+	name = normaliseFieldName(name)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || normaliseFieldName(f.Name) != name {
+			continue
+		}
+		switch f.Type {
+		case optionalFloatType, optionalIntType:
+			return i, kindNumber, true
+		case optionalStringType:
+			return i, kindText, true
+		}
+		switch f.Type.Kind() {
+		case reflect.Int, reflect.Int64, reflect.Float64:
+			return i, kindNumber, true
+		case reflect.String:
+			return i, kindText, true
+		case reflect.Bool:
+			return i, kindBool, true
+		}
+	}
+	return 0, 0, false
+}
+
+func reflectValue(v reflect.Value) conditionValue {
+	switch x := v.Interface().(type) {
+	case OptionalFloat:
+		return conditionValue{Known: x.Valid, Number: x.Value}
+	case OptionalInt:
+		return conditionValue{Known: x.Valid, Number: float64(x.Value)}
+	case OptionalString:
+		return conditionValue{Known: x.Valid, Text: x.Value}
+	case int:
+		return conditionValue{Known: true, Number: float64(x)}
+	case int64:
+		return conditionValue{Known: true, Number: float64(x)}
+	case float64:
+		return conditionValue{Known: true, Number: x}
+	case string:
+		return conditionValue{Known: true, Text: x}
+	case bool:
+		return conditionValue{Known: true, Bool: x}
+	}
+	return conditionValue{}
+}
+
+// Look up a field for a node or explain rule
+//     rows, operator, explain.runtime, settings.enable_nestloop, nodes, slices
+func lookupField(name string, nodeRule bool) (fieldCondition, error) {
+	lower := strings.ToLower(name)
+
+	if strings.HasPrefix(lower, "settings.") {
+		setting := lower[len("settings."):]
+		return fieldCondition{name, kindText, func(env conditionEnv) conditionValue {
+			if env.explain == nil {
+				return conditionValue{}
+			}
+			for _, s := range env.explain.Settings {
+				if strings.ToLower(s.Name) == setting {
+					return conditionValue{Known: true, Text: s.Value}
+				}
+			}
+			return conditionValue{}
+		}}, nil
+	}
+
+	explainField := !nodeRule
+	if nodeRule && strings.HasPrefix(lower, "explain.") {
+		explainField = true
+		lower = lower[len("explain."):]
+	}
+
+	if explainField {
+		var value func(e *Explain) conditionValue
+		switch lower {
+		case "nodes":
+			value = func(e *Explain) conditionValue {
+				return conditionValue{Known: true, Number: float64(len(e.Nodes))}
+			}
+		case "slices":
+			value = func(e *Explain) conditionValue {
+				return conditionValue{Known: true, Number: float64(len(e.SliceStats))}
+			}
+		}
+
+		k := kindNumber
+		if value == nil {
+			i, fieldKind, ok := structField(reflect.TypeOf(Explain{}), lower)
+			if !ok {
+				return fieldCondition{}, errors.New(fmt.Sprintf("Unknown field %s", name))
+			}
+			k = fieldKind
+			value = func(e *Explain) conditionValue {
+				return reflectValue(reflect.ValueOf(e).Elem().Field(i))
+			}
+		}
+
+		// Node checks can be run without a plan, e.g. in tests
+		return fieldCondition{name, k, func(env conditionEnv) conditionValue {
+			if env.explain == nil {
+				return conditionValue{}
+			}
+			return value(env.explain)
+		}}, nil
+	} else if i, k, ok := structField(reflect.TypeOf(Node{}), lower); ok {
+		return fieldCondition{name, k, func(env conditionEnv) conditionValue {
+			return reflectValue(reflect.ValueOf(env.node).Elem().Field(i))
+		}}, nil
+	}
+
+	return fieldCondition{}, errors.New(fmt.Sprintf("Unknown field %s", name))
+}
+
+// ------------------------------------------------------------
+// Literals and operators
+// ------------------------------------------------------------
+
+type literalCondition struct {
+	k     valueKind
+	value conditionValue
+}
+
+func (c literalCondition) kind() valueKind                  { return c.k }
+func (c literalCondition) eval(conditionEnv) conditionValue { return c.value }
+
+type notCondition struct {
+	operand condition
+}
+
+func (c notCondition) kind() valueKind { return kindBool }
+func (c notCondition) eval(env conditionEnv) conditionValue {
+	return conditionValue{Known: true, Bool: !c.operand.eval(env).Bool}
+}
+
+type negateCondition struct {
+	operand condition
+}
+
+func (c negateCondition) kind() valueKind { return kindNumber }
+func (c negateCondition) eval(env conditionEnv) conditionValue {
+	v := c.operand.eval(env)
+	v.Number = -v.Number
+	return v
+}
+
+// && and || only evaluate the right side when needed
+type logicalCondition struct {
+	op          string
+	left, right condition
+}
+
+func (c logicalCondition) kind() valueKind { return kindBool }
+func (c logicalCondition) eval(env conditionEnv) conditionValue {
+	left := c.left.eval(env).Bool
+	if c.op == "&&" && !left || c.op == "||" && left {
+		return conditionValue{Known: true, Bool: left}
+	}
+	return conditionValue{Known: true, Bool: c.right.eval(env).Bool}
+}
+
+type arithmeticCondition struct {
+	op          string
+	left, right condition
+}
+
+func (c arithmeticCondition) kind() valueKind { return kindNumber }
+func (c arithmeticCondition) eval(env conditionEnv) conditionValue {
+	left, right := c.left.eval(env), c.right.eval(env)
+	if !left.Known || !right.Known {
+		return conditionValue{}
+	}
+	switch c.op {
+	case "+":
+		return conditionValue{Known: true, Number: left.Number + right.Number}
+	case "-":
+		return conditionValue{Known: true, Number: left.Number - right.Number}
+	case "*":
+		return conditionValue{Known: true, Number: left.Number * right.Number}
+	}
+	if right.Number == 0 {
+		return conditionValue{}
+	}
+	return conditionValue{Known: true, Number: left.Number / right.Number}
+}
+
+type compareCondition struct {
+	op          string
+	left, right condition
+}
+
+func (c compareCondition) kind() valueKind { return kindBool }
+func (c compareCondition) eval(env conditionEnv) conditionValue {
+	left, right := c.left.eval(env), c.right.eval(env)
+	if !left.Known || !right.Known {
+		return conditionValue{Known: true, Bool: false}
+	}
+
+	var result bool
+	switch c.left.kind() {
+	case kindNumber:
+		result = compareOrdered(c.op, left.Number-right.Number)
+	case kindText:
+		result = compareOrdered(c.op, float64(strings.Compare(left.Text, right.Text)))
+	default:
+		result = (left.Bool == right.Bool) == (c.op == "==")
+	}
+	return conditionValue{Known: true, Bool: result}
+}
+
+func compareOrdered(op string, diff float64) bool {
+	switch op {
+	case "==":
+		return diff == 0
+	case "!=":
+		return diff != 0
+	case "<":
+		return diff < 0
+	case "<=":
+		return diff <= 0
+	case ">":
+		return diff > 0
+	}
+	return diff >= 0
+}
+
+type matchCondition struct {
+	negate  bool
+	operand condition
+	re      *regexp.Regexp
+}
+
+func (c matchCondition) kind() valueKind { return kindBool }
+func (c matchCondition) eval(env conditionEnv) conditionValue {
+	v := c.operand.eval(env)
+	if !v.Known {
+		return conditionValue{Known: true, Bool: false}
+	}
+	return conditionValue{Known: true, Bool: c.re.MatchString(v.Text) != c.negate}
+}
+
+// ------------------------------------------------------------
+// Parser
+// ------------------------------------------------------------
+
+type conditionToken struct {
+	text   string
+	kind   string // op, number, string, field
+	offset int
+}
+
+type conditionParser struct {
+	text     string
+	tokens   []conditionToken
+	pos      int
+	nodeRule bool
+	fields   []fieldCondition // Every field used, in order, without duplicates
+}
+
+var conditionOperators = []string{"==", "!=", "<=", ">=", "=~", "!~", "&&", "||", "<", ">", "!", "(", ")", "+", "-", "*", "/"}
+
+func tokenizeCondition(text string) ([]conditionToken, error) {
+	tokens := []conditionToken{}
+
+	i := 0
+	for i < len(text) {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+			continue
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(text) && text[end] != c {
+				if text[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(text) {
+				return nil, errors.New(fmt.Sprintf("Unterminated string at column %d", i+1))
+			}
+			value := strings.Replace(text[i+1:end], `\`+string(c), string(c), -1)
+			tokens = append(tokens, conditionToken{value, "string", i})
+			i = end + 1
+			continue
+		case c >= '0' && c <= '9' || c == '.':
+			end := i
+			for end < len(text) && (text[end] >= '0' && text[end] <= '9' || text[end] == '.' || text[end] == 'e' || text[end] == 'E' ||
+				(text[end] == '+' || text[end] == '-') && (text[end-1] == 'e' || text[end-1] == 'E')) {
+				end++
+			}
+			tokens = append(tokens, conditionToken{text[i:end], "number", i})
+			i = end
+			continue
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			end := i
+			for end < len(text) && (text[end] == '_' || text[end] == '.' || text[end] >= 'a' && text[end] <= 'z' ||
+				text[end] >= 'A' && text[end] <= 'Z' || text[end] >= '0' && text[end] <= '9') {
+				end++
+			}
+			tokens = append(tokens, conditionToken{text[i:end], "field", i})
+			i = end
+			continue
+		}
+
+		found := false
+		for _, op := range conditionOperators {
+			if strings.HasPrefix(text[i:], op) {
+				tokens = append(tokens, conditionToken{op, "op", i})
+				i += len(op)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.New(fmt.Sprintf("Unexpected %q at column %d", c, i+1))
+		}
+	}
+
+	return tokens, nil
+}
+
+// Parse a condition which must be true or false. Also returns the
+// fields used so they can be added to the warning
+func parseCondition(text string, nodeRule bool) (condition, []fieldCondition, error) {
+	tokens, err := tokenizeCondition(text)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil, errors.New("Condition is empty")
+	}
+
+	p := &conditionParser{text: text, tokens: tokens, nodeRule: nodeRule}
+	c, err := p.parseOr()
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, nil, p.errorf("Unexpected %s", p.tokens[p.pos].text)
+	}
+	if c.kind() != kindBool {
+		return nil, nil, errors.New(fmt.Sprintf("Condition must be true/false, got %s", c.kind()))
+	}
+	return c, p.fields, nil
+}
+
+func (p *conditionParser) errorf(format string, v ...interface{}) error {
+	column := len(p.text) + 1
+	if p.pos < len(p.tokens) {
+		column = p.tokens[p.pos].offset + 1
+	}
+	return errors.New(fmt.Sprintf("%s at column %d", fmt.Sprintf(format, v...), column))
+}
+
+// Consume the next token if it is one of the operators
+func (p *conditionParser) accept(ops ...string) (string, bool) {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != "op" {
+		return "", false
+	}
+	for _, op := range ops {
+		if p.tokens[p.pos].text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *conditionParser) expect(c condition, k valueKind, op string) error {
+	if c.kind() != k {
+		p.pos--
+		return p.errorf("%s needs %s, got %s", op, k, c.kind())
+	}
+	return nil
+}
+
+func (p *conditionParser) parseOr() (condition, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("||")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(left, kindBool, op); err != nil {
+			return nil, err
+		}
+		if err := p.expect(right, kindBool, op); err != nil {
+			return nil, err
+		}
+		left = logicalCondition{op, left, right}
+	}
+}
+
+func (p *conditionParser) parseAnd() (condition, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("&&")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(left, kindBool, op); err != nil {
+			return nil, err
+		}
+		if err := p.expect(right, kindBool, op); err != nil {
+			return nil, err
+		}
+		left = logicalCondition{op, left, right}
+	}
+}
+
+func (p *conditionParser) parseNot() (condition, error) {
+	if op, ok := p.accept("!"); ok {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(operand, kindBool, op); err != nil {
+			return nil, err
+		}
+		return notCondition{operand}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *conditionParser) parseCompare() (condition, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	op, ok := p.accept("==", "!=", "<=", ">=", "<", ">", "=~", "!~")
+	if !ok {
+		return left, nil
+	}
+
+	if op == "=~" || op == "!~" {
+		if err := p.expect(left, kindText, op); err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != "string" {
+			return nil, p.errorf("%s needs a quoted regular expression", op)
+		}
+		re, err := regexp.Compile(p.tokens[p.pos].text)
+		if err != nil {
+			return nil, p.errorf("Invalid regular expression %s", p.tokens[p.pos].text)
+		}
+		p.pos++
+		return matchCondition{op == "!~", left, re}, nil
+	}
+
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if right.kind() != left.kind() {
+		p.pos--
+		return nil, p.errorf("Can not compare %s with %s", left.kind(), right.kind())
+	}
+	if left.kind() == kindBool && op != "==" && op != "!=" {
+		p.pos--
+		return nil, p.errorf("%s can not be used with true/false", op)
+	}
+	return compareCondition{op, left, right}, nil
+}
+
+func (p *conditionParser) parseSum() (condition, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(left, kindNumber, op); err != nil {
+			return nil, err
+		}
+		if err := p.expect(right, kindNumber, op); err != nil {
+			return nil, err
+		}
+		left = arithmeticCondition{op, left, right}
+	}
+}
+
+func (p *conditionParser) parseProduct() (condition, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("*", "/")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(left, kindNumber, op); err != nil {
+			return nil, err
+		}
+		if err := p.expect(right, kindNumber, op); err != nil {
+			return nil, err
+		}
+		left = arithmeticCondition{op, left, right}
+	}
+}
+
+func (p *conditionParser) parseUnary() (condition, error) {
+	if op, ok := p.accept("-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(operand, kindNumber, op); err != nil {
+			return nil, err
+		}
+		return negateCondition{operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *conditionParser) parsePrimary() (condition, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, p.errorf("Unexpected end of condition")
+	}
+	token := p.tokens[p.pos]
+
+	switch token.kind {
+	case "number":
+		f, err := strconv.ParseFloat(token.text, 64)
+		if err != nil {
+			return nil, p.errorf("Invalid number %s", token.text)
+		}
+		p.pos++
+		return literalCondition{kindNumber, conditionValue{Known: true, Number: f}}, nil
+	case "string":
+		p.pos++
+		return literalCondition{kindText, conditionValue{Known: true, Text: token.text}}, nil
+	case "field":
+		switch token.text {
+		case "true", "false":
+			p.pos++
+			return literalCondition{kindBool, conditionValue{Known: true, Bool: token.text == "true"}}, nil
+		}
+		f, err := p.field(token.text)
+		if err != nil {
+			return nil, p.errorf("%s", err)
+		}
+		p.pos++
+		return f, nil
+	}
+
+	if _, ok := p.accept("("); ok {
+		c, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.accept(")"); !ok {
+			return nil, p.errorf("Expected )")
+		}
+		return c, nil
+	}
+	return nil, p.errorf("Unexpected %s", token.text)
+}
+
+// Look up a field and remember it was used
+func (p *conditionParser) field(name string) (fieldCondition, error) {
+	for _, f := range p.fields {
+		if f.name == name {
+			return f, nil
+		}
+	}
+	f, err := lookupField(name, p.nodeRule)
+	if err != nil {
+		return fieldCondition{}, err
+	}
+	p.fields = append(p.fields, f)
+	return f, nil
+}
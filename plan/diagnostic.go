@@ -0,0 +1,100 @@
+package plan
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	DiagnosticError   = "error"
+	DiagnosticWarning = "warning"
+)
+
+// A problem found while parsing the plan. Errors stop the parse unless
+// Explain.Lenient is set, in which case the line is skipped or repaired
+// and the error is kept here instead
+type Diagnostic struct {
+	Severity string // error, warning
+	Line     int    // Line number in the input starting at 1, 0 if not known
+	Column   int    // Column starting at 1, 0 if not known
+	Text     string // The offending line
+	Message  string
+}
+
+func (d Diagnostic) Error() string {
+	switch {
+	case d.Line > 0 && d.Column > 0:
+		return fmt.Sprintf("line %d, column %d: %s", d.Line, d.Column, d.Message)
+	case d.Line > 0:
+		return fmt.Sprintf("line %d: %s", d.Line, d.Message)
+	}
+	return d.Message
+}
+
+// One line summary, the message may be several lines for errors
+// which are shown to the user on their own
+func (d Diagnostic) String() string {
+	message := strings.SplitN(d.Message, "\n", 2)[0]
+	if d.Line > 0 {
+		return fmt.Sprintf("%s: line %d: %s", d.Severity, d.Line, message)
+	}
+	return fmt.Sprintf("%s: %s", d.Severity, message)
+}
+
+// Record a problem with e.lines[offset]. Errors are returned so the
+// caller can stop, unless running in lenient mode
+func (e *Explain) diagnose(severity string, offset int, column int, message string) error {
+	d := Diagnostic{
+		Severity: severity,
+		Column:   column,
+		Message:  message,
+	}
+	if offset >= 0 && offset < len(e.lines) {
+		d.Line = e.lineNumber(offset)
+		d.Text = strings.TrimRight(e.lines[offset], " ")
+	}
+
+	e.logDebugf("Diagnostic %s\n", d)
+	e.Diagnostics = append(e.Diagnostics, d)
+
+	if severity == DiagnosticError && e.Lenient == false {
+		return d
+	}
+	return nil
+}
+
+// Line number in the input of e.lines[offset] starting at 1
+func (e *Explain) lineNumber(offset int) int {
+	if offset < len(e.lineNumbers) {
+		return e.lineNumbers[offset]
+	}
+	return offset + 1
+}
+
+// Convert a byte offset to a line and column, both starting at 1
+func offsetPosition(text string, offset int64) (int, int) {
+	if offset > int64(len(text)) {
+		offset = int64(len(text))
+	}
+	before := text[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := len(before) - strings.LastIndex(before, "\n")
+	return line, column
+}
+
+// Errors from the structured formats can not be skipped so always stop
+// the parse, even in lenient mode
+func (e *Explain) structuredError(format string, plantext string, d Diagnostic) error {
+	d.Severity = DiagnosticError
+	d.Message = fmt.Sprintf("Unable to parse %s plan: %s", format, d.Message)
+	if d.Line > 0 && d.Text == "" {
+		lines := strings.Split(plantext, "\n")
+		if d.Line <= len(lines) {
+			d.Text = strings.TrimRight(lines[d.Line-1], " \r")
+		}
+	}
+
+	e.logDebugf("Diagnostic %s\n", d)
+	e.Diagnostics = append(e.Diagnostics, d)
+	return d
+}
@@ -0,0 +1,121 @@
+package plan
+
+import (
+	"context"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Second Seq Scan has lost its indentation
+var badIndentPlan = strings.Join([]string{
+	"                     QUERY PLAN",
+	"----------------------------------------------------",
+	" Hash Join  (cost=0.00..862.00 rows=1 width=16)",
+	"   Hash Cond: a.id = b.id",
+	"   ->  Seq Scan on a  (cost=0.00..431.00 rows=1 width=8)",
+	" Seq Scan on b  (cost=0.00..431.00 rows=1 width=8)",
+	"         Filter: b.x = 1",
+	" Settings:  optimizer=on",
+}, "\n")
+
+func TestDiagnostic_strict(t *testing.T) {
+	explain := Explain{}
+	err := explain.InitFromString(badIndentPlan, false)
+	if err == nil {
+		t.Fatal("Expected indentation error")
+	}
+
+	d, ok := err.(Diagnostic)
+	if !ok {
+		t.Fatalf("Expected Diagnostic, got %T", err)
+	}
+
+	if d.Severity != DiagnosticError || d.Line != 6 || d.Column != 2 || d.Text != " Seq Scan on b  (cost=0.00..431.00 rows=1 width=8)" {
+		t.Errorf("Unexpected diagnostic %+v", d)
+	}
+}
+
+func TestDiagnostic_lenient(t *testing.T) {
+	explain := Explain{Lenient: true}
+	err := explain.InitFromString(badIndentPlan, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(explain.Nodes) != 2 || explain.Plans[0].TopNode.Operator != "Hash Join" {
+		t.Fatalf("Expected the bad node to be skipped, got %d nodes", len(explain.Nodes))
+	}
+
+	// Filter belonged to the skipped node
+	if explain.Nodes[1].Filter != "" {
+		t.Errorf("Expected Filter of skipped node to be dropped, got %q", explain.Nodes[1].Filter)
+	}
+
+	if len(explain.Diagnostics) != 1 || explain.Diagnostics[0].Line != 6 {
+		t.Errorf("Expected 1 diagnostic on line 6, got %v", explain.Diagnostics)
+	}
+
+	if len(explain.Settings) != 1 {
+		t.Error("Expected settings to be parsed after the bad line")
+	}
+}
+
+func TestDiagnostic_lineNumbers(t *testing.T) {
+	input := "analytics=> explain select 1;\n" + badIndentPlan
+	explains, err := InitPlans(input, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Prompt is removed by normaliseText, the line number is still for the input
+	if explains[0].Diagnostics[0].Line != 7 {
+		t.Errorf("Expected line 7, got %d", explains[0].Diagnostics[0].Line)
+	}
+}
+
+func TestDiagnostic_json(t *testing.T) {
+	explain := Explain{}
+	err := explain.InitFromString("[\n  {\"Plan\": {\"Node Type\": \"Seq Scan\",,}}\n]", false)
+
+	d, ok := err.(Diagnostic)
+	if !ok {
+		t.Fatalf("Expected Diagnostic, got %v", err)
+	}
+	if d.Line != 2 || d.Column < 1 || !strings.HasPrefix(d.Message, "Unable to parse JSON plan") {
+		t.Errorf("Unexpected diagnostic %+v", d)
+	}
+}
+
+// Footer lines cut off after the label
+func TestDiagnostic_truncatedFooter(t *testing.T) {
+	tests := map[string]int{
+		"explain13.txt": 36,
+		"explain22.txt": 38,
+	}
+
+	for file, keep := range tests {
+		data, err := ioutil.ReadFile("../testdata/" + file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(string(data), "\n")[:keep]
+		input := strings.Join(append(lines, " Optimizer status: ", " Total runtime: "), "\n")
+
+		explains, err := ParseAll(context.Background(), strings.NewReader(input), Options{Lenient: true})
+		if err != nil {
+			t.Fatalf("%s: %s", file, err)
+		}
+
+		messages := []string{}
+		for _, d := range explains[0].Diagnostics {
+			if d.Severity == DiagnosticWarning {
+				messages = append(messages, d.Message)
+			}
+		}
+		if !reflect.DeepEqual(messages, []string{"Missing optimizer status", "Missing total runtime"}) {
+			t.Errorf("%s: unexpected diagnostics %v", file, explains[0].Diagnostics)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package plan
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Greenplum 6 and 7 print the same statement level information as
+// Greenplum 4/5 but in a different layout and with different units:
+//
+// Greenplum 4/5
+//     Slice statistics:
+//       (slice0)    Executor memory: 267K bytes.
+//       (slice1)    Executor memory: 187K bytes avg x 2 workers, 187K bytes max (seg0).
+//     Statement statistics:
+//       Memory used: 128000K bytes
+//     Settings:  optimizer=on
+//     Optimizer status: PQO version 1.620
+//     Total runtime: 5.095 ms
+//
+// Greenplum 6/7
+//     Planning time: 2.452 ms
+//       (slice0)    Executor memory: 59K bytes.
+//       (slice1)    Executor memory: 42kB avg x 3 workers, 42kB max (seg0).
+//     Memory used:  128000kB
+//     Optimizer: Pivotal Optimizer (GPORCA)
+//     Execution time: 2.048 ms
+//
+// The lines are normalised to the Greenplum 4/5 units so the rest of
+// the parser only has to handle one set of patterns.
+var dialectPatterns = map[string]*regexp.Regexp{
+	"GPDB5":     regexp.MustCompile(`^\s*(Rows out: |Optimizer status: |Slice statistics:|Total runtime: )`),
+	"GPDB6":     regexp.MustCompile(`^\s*(Optimizer: |Memory used: +[0-9]+kB)`),
+	"GREENPLUM": regexp.MustCompile(`(Motion [0-9]+:[0-9]+|\(slice[0-9]+)`),
+	"TIME":      regexp.MustCompile(`^\s*(Planning|Execution) time: `),
+	"TIME_PG13": regexp.MustCompile(`^\s*(Planning|Execution) Time: `),
+	"ACTUAL":    regexp.MustCompile(`\(actual (time|rows)=`),
+}
+
+var unitPatterns = map[string]*regexp.Regexp{
+	"MEMORYLINE": regexp.MustCompile(`(?i)(memory|work_mem)( used| wanted| usage){0,1}:`),
+	"KB":         regexp.MustCompile(`\b([0-9]+)kB\b`),
+	"MB":         regexp.MustCompile(`\b([0-9]+)MB\b`),
+	"WORKERS":    regexp.MustCompile(`x ([0-9]+)x\([0-9]+\) workers`),
+}
+
+// See patternLiterals
+var dialectLiterals = map[string][]string{
+	"GPDB5":     {"Rows out: ", "Optimizer status: ", "Slice statistics:", "Total runtime: "},
+	"GPDB6":     {"Optimizer: ", "Memory used: "},
+	"GREENPLUM": {"Motion ", "(slice"},
+	"TIME":      {" time: "},
+	"TIME_PG13": {" Time: "},
+	"ACTUAL":    {"(actual "},
+}
+
+// Dialect patterns seen so far, so the dialect can be detected while
+// the lines are normalised
+type dialectFound map[string]bool
+
+func (found dialectFound) add(line string) {
+	// Nothing else changes the dialect once Greenplum 4/5 is seen
+	if found["GPDB5"] {
+		return
+	}
+	for name, re := range dialectPatterns {
+		if !found[name] && containsLiteral(line, dialectLiterals[name]) && re.MatchString(line) {
+			found[name] = true
+		}
+	}
+}
+
+// Work out which database produced the text plan:
+//     gpdb5    Greenplum 4/5 ("Rows out:" lines)
+//     gpdb6    Greenplum 6 (PostgreSQL 9.4 style footer)
+//     gpdb7    Greenplum 7 (PostgreSQL 12 style footer)
+//     postgres PostgreSQL
+// Returns an empty string if nothing identifies it, e.g. plain EXPLAIN
+// without any footer
+func (found dialectFound) dialect() string {
+	switch {
+	case found["GPDB5"]:
+		return "gpdb5"
+	case found["GPDB6"] || found["GREENPLUM"]:
+		if found["TIME_PG13"] {
+			return "gpdb7"
+		}
+		if found["GPDB6"] || found["TIME"] || found["ACTUAL"] {
+			return "gpdb6"
+		}
+	case found["TIME"] || found["TIME_PG13"] || found["ACTUAL"]:
+		return "postgres"
+	}
+
+	return ""
+}
+
+// Convert Greenplum 6/7 memory units to the Greenplum 4/5 format
+//     Memory used:  128000kB                                  -> Memory used:  128000K bytes
+//     Executor memory: 42kB avg x 3x(0) workers, 42kB max     -> Executor memory: 42K bytes avg x 3 workers, 42K bytes max
+// Only lines about memory are changed so filters etc... are left alone
+func normaliseDialectLine(line string) string {
+	// Quick check before the case insensitive pattern, both "memory"
+	// and "work_mem" contain "mem"
+	if !containsMem(line) {
+		return line
+	}
+
+	if !unitPatterns["MEMORYLINE"].MatchString(line) {
+		return line
+	}
+
+	line = unitPatterns["KB"].ReplaceAllString(line, "${1}K bytes")
+	line = unitPatterns["MB"].ReplaceAllStringFunc(line, func(s string) string {
+		mb, _ := strconv.ParseInt(strings.TrimSuffix(s, "MB"), 10, 64)
+		return strconv.FormatInt(mb*1024, 10) + "K bytes"
+	})
+	line = unitPatterns["WORKERS"].ReplaceAllString(line, "x ${1} workers")
+
+	return line
+}
+
+// Whether the line contains "mem" in any case, without the copy
+// strings.ToLower would make
+func containsMem(line string) bool {
+	for i := 0; i+2 < len(line); i++ {
+		if line[i]|0x20 == 'm' && line[i+1]|0x20 == 'e' && line[i+2]|0x20 == 'm' {
+			return true
+		}
+	}
+	return false
+}
+
+// Store the optimizer status. If the plan was produced by ORCA then the
+// "optimizer" GUC must have been on, so set it in case there was no
+// Settings line to get it from
+func (e *Explain) setOptimizerStatus(status string) {
+	e.OptimizerStatus = status
+	if e.Optimizer == "" && patterns["OPTIMIZER_ORCA"].MatchString(status) {
+		e.Optimizer = "on"
+	}
+}
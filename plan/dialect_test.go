@@ -0,0 +1,79 @@
+package plan
+
+import "testing"
+
+func TestDialect_detect(t *testing.T) {
+	tests := []struct {
+		file    string
+		dialect string
+	}{
+		{"explain17.txt", ""},
+		{"explain02.txt", "gpdb5"},
+		{"explain23.txt", "postgres"},
+		{"explain24.txt", "gpdb6"},
+	}
+
+	for _, test := range tests {
+		explain := Explain{}
+		err := explain.InitFromFile("../testdata/"+test.file, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if explain.Dialect != test.dialect {
+			t.Errorf("%s: expected dialect %q, got %q", test.file, test.dialect, explain.Dialect)
+		}
+	}
+}
+
+func TestDialect_gpdb6(t *testing.T) {
+	explain := Explain{}
+	err := explain.InitFromFile("../testdata/explain24.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if explain.PlanningTime != KnownFloat(4.381) || explain.Runtime != KnownFloat(26.114) {
+		t.Errorf("Expected planning 4.381 and runtime 26.114, got %f and %f", explain.PlanningTime, explain.Runtime)
+	}
+
+	if explain.MemoryUsed != KnownInt(128000) {
+		t.Errorf("Expected 128000K memory used, got %d", explain.MemoryUsed)
+	}
+
+	if len(explain.SliceStats) != 3 || explain.SliceStats[1].Line != "(slice1)    Executor memory: 44K bytes avg x 4 workers, 44K bytes max (seg0)." {
+		t.Errorf("Slice statistics not normalised: %v", explain.SliceStats)
+	}
+
+	if explain.OptimizerStatus != "Postgres query optimizer" {
+		t.Errorf("Unexpected optimizer status %q", explain.OptimizerStatus)
+	}
+
+	if len(explain.Warnings) != 1 || explain.Warnings[0].Cause != "ORCA enabled but plan was produced by legacy query optimizer" {
+		t.Errorf("Expected planner fallback warning, got %v", explain.Warnings)
+	}
+}
+
+func TestDialect_normaliseLine(t *testing.T) {
+	tests := map[string]string{
+		" Memory used:  128000kB": " Memory used:  128000K bytes",
+		"(slice1)    Executor memory: 35kB avg x 3x(0) workers, 35kB max (seg0).": "(slice1)    Executor memory: 35K bytes avg x 3 workers, 35K bytes max (seg0).",
+		"   Filter: (size = '5kB'::text)":                                         "   Filter: (size = '5kB'::text)",
+		" Settings: work_mem = '64MB'":                                            " Settings: work_mem = '64MB'",
+	}
+
+	for input, expected := range tests {
+		if output := normaliseDialectLine(input); output != expected {
+			t.Errorf("%q: expected %q, got %q", input, expected, output)
+		}
+	}
+}
+
+func TestDialect_quotedSettings(t *testing.T) {
+	explain := Explain{}
+	explain.parseSettings(" Settings: enable_nestloop = 'on', optimizer = 'off'")
+
+	if len(explain.Settings) != 2 || explain.Settings[0].Value != "on" || explain.Optimizer != "off" {
+		t.Fatalf("Unexpected settings %v", explain.Settings)
+	}
+}
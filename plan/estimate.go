@@ -0,0 +1,150 @@
+package plan
+
+import (
+	"math"
+)
+
+// Number of processes the rows estimate of a node is for. Greenplum
+// estimates are per segment for nodes running on the segments, so this
+// is the senders of the motion above the node. A Gather Motion and the
+// nodes above it run once on the master, as does every PostgreSQL node
+//     Gather Motion 4:1  (slice2; segments: 4)  (cost=... rows=1000 ...)   1
+//       ->  Hash Join  (cost=... rows=250 ...)                             4
+//             ->  Broadcast Motion 4:4  (slice1; segments: 4)              4 receivers
+func (n *Node) Processes() int64 {
+	if n.MotionType != "" {
+		if n.MotionType == "Gather" {
+			return 1
+		}
+		return n.Receivers.Or(1)
+	}
+
+	motion := n.FindAncestor(func(a *Node) bool { return a.MotionType != "" })
+	if motion == nil {
+		return 1
+	}
+	return motion.Senders.Or(1)
+}
+
+// Estimated and actual rows in the same units. Greenplum "Rows out" is
+// the total for all segments so the estimate is multiplied by the
+// processes. The "(actual rows=N loops=N)" format is per process (the
+// segment with the most rows) and per loop, the same as the estimate.
+// Not ok without EXPLAIN ANALYZE or if the node never ran
+func (n *Node) RowEstimate() (float64, float64, bool) {
+	if n.NoRowRequested {
+		return 0, 0, false
+	}
+
+	estimated := float64(n.Rows)
+	var actual float64
+
+	switch {
+	case n.Loops.Valid:
+		if n.Loops.Value == 0 || !n.ActualRows.Valid {
+			return 0, 0, false
+		}
+		actual = n.ActualRows.Value
+	case n.AvgRows.Valid && n.Workers.Valid:
+		estimated *= float64(n.Processes())
+		actual = n.AvgRows.Value * float64(n.Workers.Value)
+	case n.ActualRows.Valid:
+		estimated *= float64(n.Processes())
+		actual = n.ActualRows.Value
+	default:
+		return 0, 0, false
+	}
+
+	// Rescanned nodes report the rows for all the scans, estimates are
+	// for one
+	if n.Scans.Or(1) > 1 {
+		actual /= float64(n.Scans.Value)
+	}
+
+	return estimated, actual, true
+}
+
+// How far out the estimate was, max(estimated, actual) / min(estimated,
+// actual) with both at least 1. 1 is a perfect estimate. Unknown
+// without EXPLAIN ANALYZE
+func (n *Node) QError() OptionalFloat {
+	estimated, actual, ok := n.RowEstimate()
+	if !ok {
+		return OptionalFloat{}
+	}
+	estimated = math.Max(estimated, 1)
+	actual = math.Max(actual, 1)
+	return KnownFloat(math.Max(estimated, actual) / math.Min(estimated, actual))
+}
+
+// Whether the node is misestimated given the thresholds, and if so
+// whether it was under (more rows than estimated) or over
+func (n *Node) misestimate(t Thresholds) (bool, bool) {
+	q := n.QError()
+	if !q.Valid || q.Value < t.MisestimateRatio {
+		return false, false
+	}
+	estimated, actual, _ := n.RowEstimate()
+	if math.Max(estimated, actual) < t.MisestimateRows {
+		return false, false
+	}
+	return true, actual > estimated
+}
+
+// The nodes above a misestimated node carry the error up the plan, so
+// only the lowest node where it appears is where the estimate went wrong
+func (n *Node) isLowestMisestimate(t Thresholds) bool {
+	misestimated, under := n.misestimate(t)
+	if !misestimated {
+		return false
+	}
+	for _, d := range n.Descendants() {
+		if m, u := d.misestimate(t); m && u == under {
+			return false
+		}
+	}
+	return true
+}
+
+// Rows produced by all the processes running the node, and whether they
+// are the actual rows. The estimate if not analyzed
+func (n *Node) TotalRows() (float64, bool) {
+	switch {
+	case n.NoRowRequested:
+		return 0, true
+	case n.Loops.Valid && n.ActualRows.Valid:
+		return n.ActualRows.Value * float64(n.Loops.Value) * float64(n.Processes()), true
+	case n.AvgRows.Valid && n.Workers.Valid:
+		return n.AvgRows.Value * float64(n.Workers.Value), true
+	case n.ActualRows.Valid:
+		return n.ActualRows.Value, true
+	}
+	return float64(n.Rows) * float64(n.Processes()), false
+}
+
+// Bytes a Broadcast Motion sends, every row from below it goes to each
+// receiving segment
+//     Broadcast Motion 32:32  (slice3; segments: 32)  (... rows=509103 width=41)
+//       ->  Hash Join  (... rows=15910 width=41)    15910 x 32 x 41 x 32 = 668MB
+// Not ok for other nodes or if the receivers are unknown
+func (n *Node) BroadcastBytes() (float64, bool) {
+	children := n.Children()
+	if n.MotionType != "Broadcast" || !n.Receivers.Valid || len(children) == 0 {
+		return 0, false
+	}
+	rows, _ := children[0].TotalRows()
+	return rows * float64(children[0].Width) * float64(n.Receivers.Value), true
+}
+
+// Tables read by the node or the nodes below it
+func (n *Node) SourceTables() []string {
+	tables := []string{}
+	seen := map[string]bool{}
+	for _, s := range append([]*Node{n}, n.Descendants()...) {
+		if s.ObjectType == "TABLE" && !seen[s.Object] {
+			seen[s.Object] = true
+			tables = append(tables, s.Object)
+		}
+	}
+	return tables
+}
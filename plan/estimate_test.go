@@ -0,0 +1,134 @@
+package plan
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNode_processes(t *testing.T) {
+	explain := Explain{}
+	err := explain.InitFromFile("../testdata/explain24.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Gather Motion 4:1, Hash Join, Seq Scan, Hash, Broadcast Motion 4:4
+	expected := []int64{1, 4, 4, 4, 4}
+	for i, n := range explain.Nodes[:len(expected)] {
+		if n.Processes() != expected[i] {
+			t.Errorf("%s: expected %d processes, got %d", n.Operator, expected[i], n.Processes())
+		}
+	}
+
+	// (actual rows=N loops=N) is per process
+	estimated, actual, ok := explain.Nodes[1].RowEstimate()
+	if !ok || estimated != 250 || actual != 1012 {
+		t.Errorf("Expected 250 and 1012 rows, got %v %v %v", estimated, actual, ok)
+	}
+}
+
+func TestNode_rowEstimate(t *testing.T) {
+	explain := Explain{}
+	err := explain.InitFromFile("../testdata/explain05.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rows out:  Avg 5500000.0 rows x 2 workers is the total for both segments
+	scan := explain.FindByObject("sales")[1]
+	estimated, actual, ok := scan.RowEstimate()
+	if !ok || estimated != 2 || actual != 11000000 {
+		t.Errorf("Expected 2 and 11000000 rows, got %v %v %v", estimated, actual, ok)
+	}
+	if scan.QError() != KnownFloat(5500000) {
+		t.Errorf("Unexpected q-error %v", scan.QError())
+	}
+
+	plain := Explain{}
+	err = plain.InitFromFile("../testdata/explain03.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q := plain.Nodes[0].QError(); q.Valid {
+		t.Errorf("Expected no q-error without ANALYZE, got %v", q)
+	}
+
+	// Rows out:  (No row requested) 0 rows (seg0) with 0 ms to end.
+	skipped := Explain{}
+	err = skipped.InitFromFile("../testdata/explain14.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := skipped.FindByObject("adwv_ac")[0]
+	if _, _, ok := n.RowEstimate(); ok || !n.NoRowRequested {
+		t.Error("Expected no estimate for a node which was not run")
+	}
+}
+
+func TestCheck_rowMisestimate(t *testing.T) {
+	explain := parseFileWithOptions(t, "explain05.txt", Options{EnableChecks: []string{"row-misestimate"}})
+
+	warnings := explain.AllWarnings()
+	if len(warnings) != 1 {
+		t.Fatalf("Expected 1 warning, got %v", warnings)
+	}
+
+	// Only the scan, not the Sequence, Hash or Hash Join above it
+	w := warnings[0]
+	if w.Node.Operator != "Dynamic Table Scan on sales (dynamic scan id: 2)" || w.Params["direction"] != "more" {
+		t.Errorf("Expected the lowest node to be flagged, got %+v", w)
+	}
+	if w.Resolution != "Run ANALYZE on sales and check the conditions for correlated columns" {
+		t.Errorf("Unexpected resolution %s", w.Resolution)
+	}
+
+	thresholds := DefaultThresholds()
+	thresholds.MisestimateRatio = 10000000
+	explain = parseFileWithOptions(t, "explain05.txt", Options{EnableChecks: []string{"row-misestimate"}, Thresholds: &thresholds})
+	if len(explain.AllWarnings()) != 0 {
+		t.Errorf("Expected no warnings, got %v", explain.AllWarnings())
+	}
+}
+
+func TestNode_broadcastBytes(t *testing.T) {
+	explain := Explain{}
+	err := explain.InitFromFile("../testdata/explain17.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hash Join rows=15910 width=41 on 32 segments, sent to 32 segments
+	motion := explain.FindNodes(func(n *Node) bool { return n.MotionType == "Broadcast" })[0]
+	bytes, ok := motion.BroadcastBytes()
+	if !ok || bytes != 15910*32*41*32 {
+		t.Errorf("Unexpected broadcast bytes %v %v", bytes, ok)
+	}
+	if _, ok := motion.Children()[0].BroadcastBytes(); ok {
+		t.Error("Expected no broadcast bytes for a Hash Join")
+	}
+}
+
+func TestCheck_broadcastVolume(t *testing.T) {
+	explain := parseFileWithOptions(t, "explain15.txt", Options{EnableChecks: []string{"broadcast-volume"}})
+
+	// 34906065 rows x 234 bytes to 320 segments
+	warnings := explain.AllWarnings()
+	if len(warnings) != 2 {
+		t.Fatalf("Expected 2 warnings, got %v", warnings)
+	}
+	w := warnings[0]
+	if w.Severity != SeverityCritical || w.Params["analyzed"] != true || w.Params["segments"] != int64(320) {
+		t.Errorf("Unexpected warning %+v", w)
+	}
+	if !strings.HasPrefix(w.Resolution, "Run ANALYZE on adws_activity") {
+		t.Errorf("Expected ANALYZE for the underestimated rows, got %s", w.Resolution)
+	}
+
+	thresholds := DefaultThresholds()
+	thresholds.BroadcastMB = 500
+	explain = parseFileWithOptions(t, "explain17.txt", Options{EnableChecks: []string{"broadcast-volume"}, Thresholds: &thresholds})
+	warnings = explain.AllWarnings()
+	if len(warnings) != 1 || warnings[0].Severity != SeverityWarning || warnings[0].Params["analyzed"] != false {
+		t.Errorf("Expected the estimated broadcast to be a warning, got %v", warnings)
+	}
+}
@@ -1,6 +1,7 @@
 package plan
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -19,31 +20,56 @@ type Setting struct {
 type Explain struct {
 	Nodes           []*Node // All nodes get added here
 	Plans           []*Plan // All plans get added here
-	SliceStats      []string
-	MemoryUsed      int64
-	MemoryWanted    int64
+	SliceStats      []SliceStat
+	MemoryUsed      OptionalInt
+	MemoryWanted    OptionalInt
 	Settings        []Setting
 	Optimizer       string
 	OptimizerStatus string
-	Runtime         float64
+	Runtime         OptionalFloat
+	PlanningTime    OptionalFloat
+	Format          string          // text, json, xml, yaml
+	Dialect         string          // gpdb5, gpdb6, gpdb7, postgres. Only set for text format
+	Normalisations  []Normalisation // Changes made to the text before parsing
+	Lenient         bool            // Skip or repair lines which can not be parsed instead of failing
+	Diagnostics     []Diagnostic    // Problems found while parsing
 
 	// Populated with any warning for the overall EXPLAIN output
 	Warnings []Warning
 
+	// Which checks ran and which were skipped
+	CheckRuns []CheckRun
+
+	// Thresholds the checks used
+	Thresholds Thresholds
+
+	ctx          context.Context
+	logger       Logger
 	lines        []string
+	lineNumbers  []int // Line number in the input of each line
 	lineOffset   int
 	planFinished bool
+	skipNode     bool // Lenient mode dropped the last node line so drop its details too
+
+	// Checks to run, see Options
+	registry      *Registry
+	enableChecks  []string
+	disableChecks []string
+	thresholds    *Thresholds
 }
 
 // ------------------------------------------------------------
 // ->  Seq Scan on sales_1_prt_outlying_years sales  (cost=0.00..67657.90 rows=2477 width=8)
 func (e *Explain) createNode(line string) *Node {
-	logDebugf("createNode\n")
+	e.logDebugf("createNode\n")
 	// Set node indent
 	// Rest of node parsing is handled in parseNodeExtraInfo
 	node := new(Node)
+	node.logger = e.logger
 	node.Indent = getIndent(line)
 	node.Offset = e.lineOffset
+	node.LineStart = e.lineNumber(e.lineOffset)
+	node.LineEnd = node.LineStart
 	node.ExtraInfo = []string{
 		line,
 	}
@@ -58,7 +84,7 @@ func (e *Explain) createNode(line string) *Node {
 //               Filter: atttypid = $1
 //
 func (e *Explain) createPlan(line string) *Plan {
-	logDebugf("createPlan\n")
+	e.logDebugf("createPlan\n")
 
 	plan := new(Plan)
 	plan.Name = strings.Trim(line, " ")
@@ -72,25 +98,41 @@ func (e *Explain) createPlan(line string) *Plan {
 // ------------------------------------------------------------
 // Settings:  enable_hashjoin=off; enable_indexscan=off; join_collapse_limit=1; optimizer=on
 // Settings:  optimizer=off
+// Settings: enable_nestloop = 'on', work_mem = '64MB'
 //
 func (e *Explain) parseSettings(line string) {
-	logDebugf("parseSettings\n")
+	e.logDebugf("parseSettings\n")
 	e.planFinished = true
 	line = strings.TrimSpace(line)
-	line = line[11:]
+	line = strings.TrimSpace(line[9:])
+
+	// PostgreSQL 12+ quotes each value
+	if matchPattern("SETTING_QUOTED", line) {
+		for _, m := range patterns["SETTING_QUOTED"].FindAllStringSubmatch(line, -1) {
+			e.addSetting(m[1], strings.Replace(m[2], "''", "'", -1))
+		}
+		return
+	}
+
 	settings := strings.Split(line, "; ")
 	for _, setting := range settings {
-		temp := strings.Split(setting, "=")
-		e.Settings = append(e.Settings, Setting{temp[0], temp[1]})
-		logDebugf("\t%s\n", setting)
-
-		// Store actual status of optimizer
-		if temp[0] == "optimizer" {
-			e.Optimizer = temp[1]
+		temp := strings.SplitN(setting, "=", 2)
+		if len(temp) == 2 {
+			e.addSetting(temp[0], temp[1])
 		}
 	}
 }
 
+func (e *Explain) addSetting(name string, value string) {
+	e.Settings = append(e.Settings, Setting{name, value})
+	e.logDebugf("\t%s=%s\n", name, value)
+
+	// Store actual status of optimizer
+	if name == "optimizer" {
+		e.Optimizer = value
+	}
+}
+
 // ------------------------------------------------------------
 // Slice statistics:
 //   (slice0) Executor memory: 2466K bytes.
@@ -98,12 +140,12 @@ func (e *Explain) parseSettings(line string) {
 //   (slice2) * Executor memory: 153897K bytes avg x 96 workers, 153981K bytes max (seg71). Work_mem: 153588K bytes max, 1524650K bytes wanted.
 //
 func (e *Explain) parseSliceStats(line string) {
-	logDebugf("parseSliceStats\n")
+	e.logDebugf("parseSliceStats\n")
 	e.planFinished = true
 	for i := e.lineOffset + 1; i < len(e.lines); i++ {
 		if getIndent(e.lines[i]) > 1 {
-			logDebugf("%s\n", e.lines[i])
-			e.SliceStats = append(e.SliceStats, strings.TrimSpace(e.lines[i]))
+			e.logDebugf("%s\n", e.lines[i])
+			e.SliceStats = append(e.SliceStats, parseSliceStat(e.lines[i]))
 		} else {
 			e.lineOffset = i - 1
 			break
@@ -111,27 +153,67 @@ func (e *Explain) parseSliceStats(line string) {
 	}
 }
 
+// Parse a single slice statistics line
+//   (slice0)    Executor memory: 267K bytes.
+//   (slice1)    Executor memory: 187K bytes avg x 2 workers, 187K bytes max (seg0).
+//   (slice2)  * Executor memory: 205132K bytes avg x 2 workers, 205136K bytes max (seg0).  Work_mem: 127501K bytes max, 171875K bytes wanted.
+func parseSliceStat(line string) SliceStat {
+	line = strings.TrimSpace(line)
+
+	stat := SliceStat{
+		Line: line,
+	}
+
+	if m := findPattern("SLICESTATS_1", line); len(m) == 3 {
+		stat.Name = m[1]
+		stat.Slice = parseOptionalInt(strings.TrimPrefix(m[1], "slice"))
+		stat.MemoryAvg = parseOptionalInt(m[2])
+	}
+
+	if m := findPattern("SLICESTATS_2", line); len(m) == 4 {
+		stat.Workers = parseOptionalInt(m[1])
+		stat.MemoryMax = parseOptionalInt(m[2])
+		stat.MaxSeg = KnownString(m[3])
+	} else if stat.MemoryAvg.Valid {
+		// Only one process (QD) so avg and max are the same
+		stat.Workers = KnownInt(1)
+		stat.MemoryMax = stat.MemoryAvg
+	}
+
+	if m := findPattern("SLICESTATS_3", line); len(m) == 2 {
+		stat.WorkMem = parseOptionalInt(m[1])
+	}
+
+	if m := findPattern("SLICESTATS_4", line); len(m) == 2 {
+		stat.WorkMemWanted = parseOptionalInt(m[1])
+	}
+
+	stat.IsConstrained = matchPattern("SLICESTATS_5", line)
+
+	return stat
+}
+
 // ------------------------------------------------------------
 // Statement statistics:
 //   Memory used: 128000K bytes
 //   Memory wanted: 1525449K bytes
 //
 func (e *Explain) parseStatementStats(line string) {
-	logDebugf("parseStatementStats\n")
+	e.logDebugf("parseStatementStats\n")
 	e.planFinished = true
 
-	e.MemoryUsed = -1
-	e.MemoryWanted = -1
+	e.MemoryUsed = OptionalInt{}
+	e.MemoryWanted = OptionalInt{}
 
 	for i := e.lineOffset + 1; i < len(e.lines); i++ {
 		if getIndent(e.lines[i]) > 1 {
-			logDebugf(e.lines[i])
-			if patterns["STATEMENTSTATS_USED"].MatchString(e.lines[i]) {
-				groups := patterns["STATEMENTSTATS_USED"].FindStringSubmatch(e.lines[i])
-				e.MemoryUsed, _ = strconv.ParseInt(strings.TrimSpace(groups[1]), 10, 64)
-			} else if patterns["STATEMENTSTATS_WANTED"].MatchString(e.lines[i]) {
-				groups := patterns["STATEMENTSTATS_WANTED"].FindStringSubmatch(e.lines[i])
-				e.MemoryWanted, _ = strconv.ParseInt(strings.TrimSpace(groups[1]), 10, 64)
+			e.logDebugf("%s\n", e.lines[i])
+			if matchPattern("STATEMENTSTATS_USED", e.lines[i]) {
+				groups := findPattern("STATEMENTSTATS_USED", e.lines[i])
+				e.MemoryUsed = parseOptionalInt(groups[1])
+			} else if matchPattern("STATEMENTSTATS_WANTED", e.lines[i]) {
+				groups := findPattern("STATEMENTSTATS_WANTED", e.lines[i])
+				e.MemoryWanted = parseOptionalInt(groups[1])
 			}
 		} else {
 			e.lineOffset = i - 1
@@ -145,46 +227,96 @@ func (e *Explain) parseStatementStats(line string) {
 //  Optimizer status: PQO version 1.620
 //
 func (e *Explain) parseOptimizer(line string) {
-	logDebugf("PARSE OPTIMIZER\n")
+	e.logDebugf("PARSE OPTIMIZER\n")
+	e.planFinished = true
+	temp := strings.SplitN(strings.TrimSpace(line), ": ", 2)
+	if len(temp) < 2 || strings.TrimSpace(temp[1]) == "" {
+		e.diagnose(DiagnosticWarning, e.lineOffset, getIndent(line)+1, "Missing optimizer status")
+		return
+	}
+	e.setOptimizerStatus(strings.TrimSpace(temp[1]))
+	e.logDebugf("\t%s\n", e.OptimizerStatus)
+}
+
+// ------------------------------------------------------------
+//  Optimizer: Pivotal Optimizer (GPORCA)
+//  Optimizer: Postgres query optimizer
+//
+func (e *Explain) parseOptimizerName(line string) {
+	e.logDebugf("PARSE OPTIMIZER NAME\n")
 	e.planFinished = true
 	line = strings.TrimSpace(line)
-	line = line[11:]
-	temp := strings.Split(line, ": ")
-	e.OptimizerStatus = temp[1]
-	logDebugf("\t%s\n", e.OptimizerStatus)
+	e.setOptimizerStatus(strings.TrimSpace(line[10:]))
+	e.logDebugf("\t%s\n", e.OptimizerStatus)
+}
+
+// ------------------------------------------------------------
+//  Planning time: 2.452 ms
+//  Execution time: 2.048 ms
+//
+func (e *Explain) parseTiming(line string) {
+	e.logDebugf("PARSE TIMING\n")
+	e.planFinished = true
+	if m := findPattern("PLANNINGTIME", line); len(m) == 2 {
+		e.PlanningTime = parseOptionalFloat(m[1])
+		e.logDebugf("\tPlanningTime %f\n", e.PlanningTime)
+	} else if m := findPattern("EXECUTIONTIME", line); len(m) == 2 {
+		e.Runtime = parseOptionalFloat(m[1])
+		e.logDebugf("\tRuntime %f\n", e.Runtime)
+	}
+}
+
+// ------------------------------------------------------------
+//  Memory used:  128000K bytes
+//  Memory wanted:  1525449K bytes
+// Same as Statement statistics but without the heading.
+// Units have already been normalised from kB
+//
+func (e *Explain) parseMemory(line string) {
+	e.logDebugf("PARSE MEMORY\n")
+	e.planFinished = true
+	if m := findPattern("STATEMENTSTATS_USED", line); len(m) == 2 {
+		e.MemoryUsed = parseOptionalInt(m[1])
+	} else if m := findPattern("STATEMENTSTATS_WANTED", line); len(m) == 2 {
+		e.MemoryWanted = parseOptionalInt(m[1])
+	}
 }
 
 // ------------------------------------------------------------
 // Total runtime: 7442.441 ms
 //
 func (e *Explain) parseRuntime(line string) {
-	logDebugf("PARSE RUNTIME\n")
+	e.logDebugf("PARSE RUNTIME\n")
 	e.planFinished = true
-	line = strings.TrimSpace(line)
-	temp := strings.Split(line, " ")
+	temp := strings.Fields(line)
+	if len(temp) < 3 {
+		e.diagnose(DiagnosticWarning, e.lineOffset, getIndent(line)+1, "Missing total runtime")
+		return
+	}
 	if s, err := strconv.ParseFloat(temp[2], 64); err == nil {
-		e.Runtime = s
+		e.Runtime = KnownFloat(s)
 	}
-	logDebugf("\t%f\n", e.Runtime)
+	e.logDebugf("\t%f\n", e.Runtime)
 }
 
 // Parse all the lines in to empty structs with only ExtraInfo populated
 func (e *Explain) parseLines() error {
-	logDebugf("ParseLines\n")
-	logDebugf("Parsing %d lines\n", len(e.lines))
+	e.logDebugf("ParseLines\n")
+	e.logDebugf("Parsing %d lines\n", len(e.lines))
 	e.planFinished = false
 
-	// Check every line for quotes.
-	// Easier to do it in one go here rather than multiple places in code.
-	for e.lineOffset = 0; e.lineOffset < len(e.lines); e.lineOffset++ {
-		e.lines[e.lineOffset] = checkQuote(e.lines[e.lineOffset])
-	}
-
 	var err error
 	// Loop through lines
 	for e.lineOffset = 0; e.lineOffset < len(e.lines); e.lineOffset++ {
-		logDebugf("------------------------------ LINE %d ------------------------------\n", e.lineOffset+1)
-		logDebugf("%s\n", e.lines[e.lineOffset])
+		// Allow long plans to be cancelled
+		if e.lineOffset%1000 == 0 {
+			if err := e.context().Err(); err != nil {
+				return err
+			}
+		}
+
+		e.logDebugf("------------------------------ LINE %d ------------------------------\n", e.lineOffset+1)
+		e.logDebugf("%s\n", e.lines[e.lineOffset])
 		err = e.parseline(e.lines[e.lineOffset])
 		if err != nil {
 			return err
@@ -202,18 +334,30 @@ func (e *Explain) parseline(line string) error {
 
 	// Ignore whitespace, "QUERY PLAN" and "-"
 	if len(strings.TrimSpace(line)) == 0 || strings.Index(line, "QUERY PLAN") > -1 || line[:1] == "-" {
-		logDebugf("SKIPPING\n")
+		e.logDebugf("SKIPPING\n")
 
-	} else if patterns["NODE"].MatchString(line) {
+	} else if isNodeLine(line) {
 		// Parse a new node
 		newNode := e.createNode(line)
+		e.skipNode = false
 
+		// Lenient mode keeps the node as the tree only relies on
+		// the indent of the nodes below it being larger
 		if len(e.Nodes) == 0 && newNode.Indent > 1 {
-			return errors.New(fmt.Sprintf("Detected wrong indentation on first plan node:\n%s\n\nRecommend running EXPLAIN again and resubmitting the plan.\nDo not manually adjust the indentation as this will lead to incorrect parsing!\n", strings.TrimRight(line, " ")))
+			err := e.diagnose(DiagnosticError, e.lineOffset, newNode.Indent+1, fmt.Sprintf("Detected wrong indentation on first plan node:\n%s\n\nRecommend running EXPLAIN again and resubmitting the plan.\nDo not manually adjust the indentation as this will lead to incorrect parsing!\n", strings.TrimRight(line, " ")))
+			if err != nil {
+				return err
+			}
 		}
 
+		// Lenient mode drops the node as it would replace the top node
 		if len(e.Nodes) > 0 && newNode.Indent < 2 {
-			return errors.New(fmt.Sprintf("Detected wrong indentation on line:\n%s\n\nRecommend running EXPLAIN again and resubmitting the plan.\nDo not manually adjust the indentation as this will lead to incorrect parsing!\n", strings.TrimRight(line, " ")))
+			err := e.diagnose(DiagnosticError, e.lineOffset, newNode.Indent+1, fmt.Sprintf("Detected wrong indentation on line:\n%s\n\nRecommend running EXPLAIN again and resubmitting the plan.\nDo not manually adjust the indentation as this will lead to incorrect parsing!\n", strings.TrimRight(line, " ")))
+			if err != nil {
+				return err
+			}
+			e.skipNode = true
+			return nil
 		}
 
 		// If this is the first node then insert the TopPlan also
@@ -225,35 +369,57 @@ func (e *Explain) parseline(line string) error {
 		// Append node to Nodes array
 		e.Nodes = append(e.Nodes, newNode)
 
-	} else if patterns["SUBPLAN"].MatchString(line) {
+	} else if matchPattern("SUBPLAN", line) {
 		// Parse a new plan
 		newPlan := e.createPlan(line)
 
 		// Append plan to Plans array
 		e.Plans = append(e.Plans, newPlan)
 
-	} else if patterns["SLICESTATS"].MatchString(line) {
+	} else if matchPattern("SLICESTATS", line) {
 		e.parseSliceStats(line)
 
-	} else if patterns["STATEMENTSTATS"].MatchString(line) {
+	} else if matchPattern("STATEMENTSTATS", line) {
 		e.parseStatementStats(line)
-	} else if patterns["SETTINGS"].MatchString(line) {
+	} else if matchPattern("SETTINGS", line) {
 		e.parseSettings(line)
 
-	} else if patterns["OPTIMIZER"].MatchString(line) {
+	} else if matchPattern("OPTIMIZER", line) {
 		e.parseOptimizer(line)
 
-	} else if patterns["RUNTIME"].MatchString(line) {
+	} else if matchPattern("RUNTIME", line) {
 		e.parseRuntime(line)
 
+	} else if matchPattern("OPTIMIZER_NAME", line) {
+		e.parseOptimizerName(line)
+
+	} else if matchPattern("PLANNINGTIME", line) || matchPattern("EXECUTIONTIME", line) {
+		e.parseTiming(line)
+
+	} else if matchPattern("MEMORY", line) {
+		e.parseMemory(line)
+
+	} else if matchPattern("SLICESTATS_LINE", line) {
+		// Greenplum 6/7 has no "Slice statistics:" heading
+		e.planFinished = true
+		e.SliceStats = append(e.SliceStats, parseSliceStat(line))
+
 	} else if indent > 1 && e.planFinished == false {
 		// Only add if node exists
-		if len(e.Nodes) > 0 {
+		if e.skipNode {
+			e.logDebugf("SKIPPING\n")
+		} else if len(e.Nodes) > 0 {
 			// Append this line to ExtraInfo on the last node
 			e.Nodes[len(e.Nodes)-1].ExtraInfo = append(e.Nodes[len(e.Nodes)-1].ExtraInfo, line)
+			e.Nodes[len(e.Nodes)-1].LineEnd = e.lineNumber(e.lineOffset)
 		}
+	} else if len(e.Nodes) > 0 && e.planFinished == false {
+		// Anything at the top level after the first node should
+		// have been picked up above
+		e.diagnose(DiagnosticWarning, e.lineOffset, indent+1, "Ignored unrecognised line")
+
 	} else {
-		logDebugf("SKIPPING\n")
+		e.logDebugf("SKIPPING\n")
 
 	}
 
@@ -281,75 +447,71 @@ func (e *Explain) parseline(line string) error {
 //                     SubPlans[]
 //
 func (e *Explain) BuildTree() {
-	logDebugf("########## START BUILD TREE ##########\n")
-
-	// Walk backwards through the Plans array and a
-	logDebugf("########## PLANS ##########\n")
-	for i := len(e.Plans) - 1; i > -1; i-- {
-		logDebugf("%d %s\n", e.Plans[i].Indent, e.Plans[i].Name)
-
-		// Loop upwards to find parent
-		for p := len(e.Nodes) - 1; p > -1; p-- {
-			logDebugf("\t%d %s\n", e.Nodes[p].Indent, e.Nodes[p].Operator)
-			if e.Plans[i].Indent > e.Nodes[p].Indent && e.Plans[i].Offset > e.Nodes[p].Offset {
-				logDebugf("\t\tFOUND PARENT NODE\n")
-				// Prepend to start of array to keep ordering
-				e.Nodes[p].SubPlans = append([]*Plan{e.Plans[i]}, e.Nodes[p].SubPlans...)
-				break
-			}
-		}
-	}
-
-	// Insert Nodes
-	logDebugf("########## NODES ##########\n")
-	for i := len(e.Nodes) - 1; i > -1; i-- {
-		logDebugf("%d %s\n", e.Nodes[i].Indent, e.Nodes[i].Operator)
+	e.logDebugf("########## START BUILD TREE ##########\n")
 
-		foundParent := false
+	if len(e.Nodes) == 0 {
+		return
+	}
 
-		// Loop upwards to find parent
+	// The top node of a SubPlan is always Indent+2 and on the next line
+	//  SubPlan 1
+	//    ->  Limit  (cost=0.00..9.23 rows=1 width=0)
+	// Plans[0] is the top level plan so it is not included
+	subPlans := map[int]*Plan{}
+	for _, p := range e.Plans[1:] {
+		subPlans[p.Offset] = p
+	}
 
-		// First check for parent plans
-		for p := len(e.Plans) - 1; p > -1; p-- {
-			logDebugf("\t%d %s\n", e.Plans[p].Indent, e.Plans[p].Name)
-			// If the parent is a SubPlan it will always be Indent-2 and Offset-1
-			//  SubPlan 1
-			//    ->  Limit  (cost=0.00..9.23 rows=1 width=0)
-			if (e.Nodes[i].Indent-2) == e.Plans[p].Indent && (e.Nodes[i].Offset-1) == e.Plans[p].Offset {
-				logDebugf("\t\tFOUND PARENT PLAN\n")
-				// Prepend to start of array to keep ordering
-				e.Plans[p].TopNode = e.Nodes[i]
-				foundParent = true
-				break
+	// Single pass through the lines keeping a stack of the nodes which
+	// could still be a parent. Each node on the stack has a smaller
+	// indent than the one above it so the parent of a node or plan is
+	// the closest one on the stack with a smaller indent.
+	stack := []*Node{}
+	nextPlan := 1
+	foundTopNode := false
+
+	addPlans := func(offset int) {
+		for ; nextPlan < len(e.Plans) && e.Plans[nextPlan].Offset < offset; nextPlan++ {
+			p := e.Plans[nextPlan]
+			e.logDebugf("%d %s\n", p.Indent, p.Name)
+			for s := len(stack) - 1; s > -1; s-- {
+				if stack[s].Indent < p.Indent {
+					e.logDebugf("\t\tFOUND PARENT NODE %s\n", stack[s].Operator)
+					stack[s].SubPlans = append(stack[s].SubPlans, p)
+					break
+				}
 			}
 		}
+	}
 
-		if foundParent == true {
-			continue
-		}
+	for _, n := range e.Nodes {
+		addPlans(n.Offset)
+		e.logDebugf("%d %s\n", n.Indent, n.Operator)
 
-		foundParent = false
-
-		// Then check for parent nodes
-		for p := i - 1; p > -1; p-- {
-			logDebugf("\t%d %s\n", e.Nodes[p].Indent, e.Nodes[p].Operator)
-			if e.Nodes[i].Indent > e.Nodes[p].Indent {
-				logDebugf("\t\tFOUND PARENT NODE\n")
-				// Prepend to start of array to keep ordering
-				e.Nodes[p].SubNodes = append([]*Node{e.Nodes[i]}, e.Nodes[p].SubNodes...)
-				foundParent = true
-				break
-			}
+		for len(stack) > 0 && stack[len(stack)-1].Indent >= n.Indent {
+			stack = stack[:len(stack)-1]
 		}
 
-		//
-		if foundParent == false {
-			logDebugf("\t\tTOPNODE\n")
-			e.Plans[0].TopNode = e.Nodes[i]
+		if p, ok := subPlans[n.Offset-1]; ok && p.Indent == n.Indent-2 {
+			e.logDebugf("\t\tFOUND PARENT PLAN %s\n", p.Name)
+			p.TopNode = n
+		} else if len(stack) > 0 {
+			e.logDebugf("\t\tFOUND PARENT NODE %s\n", stack[len(stack)-1].Operator)
+			stack[len(stack)-1].SubNodes = append(stack[len(stack)-1].SubNodes, n)
+		} else if foundTopNode == false {
+			e.logDebugf("\t\tTOPNODE\n")
+			e.Plans[0].TopNode = n
+			foundTopNode = true
 		}
+
+		stack = append(stack, n)
 	}
 
-	logDebugf("########## END BUILD TREE ##########\n")
+	// SubPlans after the last node have no top node but still belong
+	// to a parent
+	addPlans(len(e.lines))
+
+	e.logDebugf("########## END BUILD TREE ##########\n")
 }
 
 // Render explain for output to console
@@ -362,24 +524,48 @@ func (e *Explain) PrintPlan() {
 		fmt.Printf("\n")
 		for _, w := range e.Warnings {
 			fmt.Printf("\x1b[%dm", warningColor)
-			fmt.Printf("WARNING: %s | %s\n", w.Cause, w.Resolution)
+			fmt.Printf("%s\n", w)
 			fmt.Printf("\x1b[%dm", 0)
 		}
 	}
 
 	fmt.Printf("\n")
 
+	if len(e.Diagnostics) > 0 {
+		fmt.Println("Diagnostics:")
+		for _, d := range e.Diagnostics {
+			fmt.Printf("\t%s\n", d)
+			if d.Text != "" {
+				fmt.Printf("\t\t%s\n", strings.TrimSpace(d.Text))
+			}
+		}
+	}
+
+	if len(e.Normalisations) > 0 {
+		fmt.Println("Input normalised:")
+		for _, n := range e.Normalisations {
+			fmt.Printf("\t%s\n", n)
+		}
+	}
+
+	if edges := e.SliceGraph(); len(edges) > 0 {
+		fmt.Println("Slice graph:")
+		for _, edge := range edges {
+			fmt.Printf("\t%s\n", edge)
+		}
+	}
+
 	if len(e.SliceStats) > 0 {
 		fmt.Println("Slice statistics:")
 		for _, stat := range e.SliceStats {
-			fmt.Printf("\t%s\n", stat)
+			fmt.Printf("\t%s\n", stat.Line)
 		}
 	}
 
-	if e.MemoryUsed > 0 {
+	if e.MemoryUsed.Valid {
 		fmt.Println("Statement statistics:")
 		fmt.Printf("\tMemory used: %d\n", e.MemoryUsed)
-		if e.MemoryWanted > 0 {
+		if e.MemoryWanted.Valid {
 			fmt.Printf("\tMemory wanted: %d\n", e.MemoryWanted)
 		}
 	}
@@ -396,40 +582,67 @@ func (e *Explain) PrintPlan() {
 		fmt.Printf("\t%s\n", e.OptimizerStatus)
 	}
 
-	if e.Runtime > 0 {
+	if e.PlanningTime.Valid {
+		fmt.Println("Planning time:")
+		fmt.Printf("\t%.3f ms\n", e.PlanningTime)
+	}
+
+	if e.Runtime.Valid {
 		fmt.Println("Total runtime:")
 		fmt.Printf("\t%.0f ms\n", e.Runtime)
 	}
 
+	if len(e.CheckRuns) > 0 {
+		ran, skipped := e.CheckCounts()
+		fmt.Println("Checks:")
+		fmt.Printf("\t%d ran, %d skipped\n", ran, skipped)
+		fmt.Printf("\tThresholds: %s\n", e.Thresholds)
+		for _, c := range e.CheckRuns {
+			if c.Status == CheckSkipped {
+				fmt.Printf("\t%s\n", c)
+			}
+		}
+	}
+
 }
 
 // Main init function
 func (e *Explain) InitPlan(plantext string) error {
+	var err error
 
-	// Split the data in to lines
-	e.lines = strings.Split(string(plantext), "\n")
-
-	// Parse lines in to node objects
-	err := e.parseLines()
+	e.Format = detectFormat(plantext)
+	if e.Format == "text" {
+		// Remove anything psql/pgAdmin added, structured formats pasted
+		// from psql are in the same layout
+		lines, numbers, changes, dialect := normaliseText(strings.Split(plantext, "\n"))
+		if structured, removed, ok := unwrapStructured(lines, numbers); ok {
+			plantext = structured
+			e.Format = detectFormat(structured)
+			e.Normalisations = append(changes, removed...)
+		} else {
+			e.lines, e.lineNumbers, e.Normalisations = lines, numbers, changes
+			if e.Dialect == "" {
+				e.Dialect = dialect
+			}
+		}
+	}
+	e.logDebugf("Detected format %s\n", e.Format)
+
+	switch e.Format {
+	case "json":
+		err = e.parseJSON(plantext)
+	case "xml":
+		err = e.parseXML(plantext)
+	case "yaml":
+		err = e.parseYAML(plantext)
+	default:
+		err = e.parseText()
+	}
 	if err != nil {
 		return err
 	}
 
-	if len(e.Nodes) == 0 {
-		return errors.New("Could not find any nodes in plan")
-	}
-
-	// Convert array of nodes to tree structure
-	e.BuildTree()
-
-	// Parse all nodes first so they are fully populated
-	for _, n := range e.Nodes {
-		// Parse ExtraInfo
-		err := parseNodeExtraInfo(n)
-		if err != nil {
-			return err
-		}
-	}
+	e.linkTree()
 
 	// If first node is an INSERT node then it will not have any startup or total cost
 	// template1=# explain insert INTO tbl1 select * from tbl1 ;
@@ -442,92 +655,120 @@ func (e *Explain) InitPlan(plantext string) error {
 			e.Nodes[0].StartupCost = e.Nodes[1].StartupCost
 			e.Nodes[0].MsEnd = e.Nodes[1].MsEnd
 			e.Nodes[0].MsOffset = e.Nodes[1].MsOffset
+			e.Nodes[0].Loops = e.Nodes[1].Loops
 			e.Nodes[0].IsAnalyzed = e.Nodes[1].IsAnalyzed
 		}
 	}
 
-	// Loop again to perform checks
+	if err := e.context().Err(); err != nil {
+		return err
+	}
+
 	for _, n := range e.Nodes {
 		n.CalculateSubNodeDiff()
 
 		// Pass in Cost + Time of top node as it should be equal to total
-		n.CalculatePercentage(e.Nodes[0].TotalCost, e.Nodes[0].MsEnd)
-
-		// Run Node checks
-		for _, c := range NODECHECKS {
-			c.Exec(n)
-		}
+		n.CalculatePercentage(e.Nodes[0].TotalCost, e.Nodes[0].MsTotal())
 	}
 
-	// Run Explain checks
-	for _, c := range EXPLAINCHECKS {
-		c.Exec(e)
-	}
+	// Checks can look at other nodes so only run them once every node
+	// has been calculated
+	e.runChecks()
 
 	return nil
 }
 
-// Init from stdin (useful for psql -f myquery.sql > planchecker)
-// planchecker will handle reading from stdin
-func (e *Explain) InitFromStdin(debug bool) error {
-	logDebug = debug
-
-	logDebugf("InitFromStdin\n")
+// Work out which EXPLAIN format the text is in.
+// Structured formats are recognised by their first character,
+// anything else is treated as the psql text layout.
+func detectFormat(plantext string) string {
+	trimmed := strings.TrimSpace(plantext)
 
-	fi, err := os.Stdin.Stat()
-	if err != nil {
-		panic(err)
+	if strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "{") {
+		return "json"
 	}
 
-	if fi.Size() == 0 {
-		return errors.New("stdin is empty")
+	if strings.HasPrefix(trimmed, "<") {
+		return "xml"
 	}
 
-	bytes, _ := ioutil.ReadAll(os.Stdin)
-	plantext := string(bytes)
-
-	e.InitPlan(plantext)
+	// - Plan:
+	//     Node Type: "Seq Scan"
+	if strings.HasPrefix(trimmed, "- Plan:") || strings.HasPrefix(trimmed, "Plan:") {
+		return "yaml"
+	}
 
-	return nil
+	return "text"
 }
 
-// Init from string
-func (e *Explain) InitFromString(plantext string, debug bool) error {
-	logDebug = debug
-
-	logDebugf("InitFromString\n")
+// Parse the psql text layout in e.lines, already normalised by InitPlan,
+// in to Nodes and Plans
+func (e *Explain) parseText() error {
+	for _, n := range e.Normalisations {
+		e.logDebugf("Normalised %s\n", n)
+	}
+	e.logDebugf("Detected dialect %s\n", e.Dialect)
 
-	err := e.InitPlan(plantext)
+	// Parse lines in to node objects
+	err := e.parseLines()
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-// Init from file
-func (e *Explain) InitFromFile(filename string, debug bool) error {
-	logDebug = debug
+	if len(e.Nodes) == 0 {
+		return errors.New("Could not find any nodes in plan")
+	}
 
-	logDebugf("InitFromFile\n")
+	// Convert array of nodes to tree structure
+	e.BuildTree()
 
-	// Check file exists
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		return err
+	// Parse all nodes first so they are fully populated
+	for _, n := range e.Nodes {
+		// Parse ExtraInfo
+		err := parseNodeExtraInfo(n)
+		if err != nil {
+			err = e.diagnose(DiagnosticError, n.Offset, n.Indent+1, err.Error())
+			if err != nil {
+				return err
+			}
+			// Keep the node in the tree with whatever can be read from it
+			n.Init()
+			n.Operator = strings.Trim(patterns["NODE"].ReplaceAllString(n.ExtraInfo[0], "$1"), " ->")
+			n.Slice = OptionalInt{}
+			parseNodeMotion(n, n.ExtraInfo[0])
+		}
 	}
 
-	// Read all lines
-	filedata, err := ioutil.ReadFile(filename)
+	return nil
+}
+
+// Init from stdin (useful for psql -f myquery.sql > planchecker)
+// planchecker will handle reading from stdin
+func (e *Explain) InitFromStdin(debug bool) error {
+	bytes, err := ioutil.ReadAll(os.Stdin)
 	if err != nil {
 		return err
 	}
 
-	plantext := string(filedata)
+	if len(bytes) == 0 {
+		return errors.New("stdin is empty")
+	}
+
+	return e.initFromReader(strings.NewReader(string(bytes)), debug)
+}
+
+// Init from string
+func (e *Explain) InitFromString(plantext string, debug bool) error {
+	return e.initFromReader(strings.NewReader(plantext), debug)
+}
 
-	err = e.InitPlan(plantext)
+// Init from file
+func (e *Explain) InitFromFile(filename string, debug bool) error {
+	f, err := os.Open(filename)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 
-	return nil
+	return e.initFromReader(f, debug)
 }
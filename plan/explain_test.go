@@ -10,3 +10,103 @@ func TestType1(t *testing.T) {
 		t.Fatal("Type1 test fail")
 	}
 }
+
+func TestExplain_sliceStats(t *testing.T) {
+	explain := Explain{}
+	err := explain.InitFromFile("../testdata/explain05.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(explain.SliceStats) != 3 {
+		t.Fatalf("Expected 3 slices, got %d", len(explain.SliceStats))
+	}
+
+	qd := explain.SliceStats[0]
+	if qd.Name != "slice0" || qd.MemoryAvg != KnownInt(203) || qd.MemoryMax != KnownInt(203) || qd.Workers != KnownInt(1) || qd.IsConstrained {
+		t.Errorf("Unexpected slice0 %+v", qd)
+	}
+
+	s := explain.SliceStats[2]
+	if s.Slice != KnownInt(2) || s.MemoryAvg != KnownInt(205132) || s.Workers != KnownInt(2) || s.MemoryMax != KnownInt(205136) || s.MaxSeg != KnownString("seg0") ||
+		s.WorkMem != KnownInt(127501) || s.WorkMemWanted != KnownInt(171875) || !s.IsConstrained {
+		t.Errorf("Unexpected slice2 %+v", s)
+	}
+
+	found := false
+	for _, w := range explain.Warnings {
+		if w.Cause == "slice2 wanted 171875K bytes work_mem but only used 127501K bytes" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected work_mem warning for slice2")
+	}
+}
+
+func TestExplain_hashChain(t *testing.T) {
+	explain := Explain{}
+	err := explain.InitFromFile("../testdata/explain13.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := explain.Nodes[1]
+	if n.HashChainAvg != KnownFloat(1111.0) || n.HashChainMax != KnownInt(2000) || n.HashBucketsUsed != KnownInt(3) || n.HashBuckets != KnownInt(1048589) || n.HashSeg != KnownString("seg1") {
+		t.Fatalf("Hash chain not parsed: %f %d %d %d %s", n.HashChainAvg, n.HashChainMax, n.HashBucketsUsed, n.HashBuckets, n.HashSeg)
+	}
+
+	found := false
+	for _, w := range n.Warnings {
+		if w.Resolution == "Check join keys t1.a, t2.b for skewed or low cardinality values" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected hash chain warning, got %v", n.Warnings)
+	}
+}
+
+func TestExplain_sliceGraph(t *testing.T) {
+	explain := Explain{}
+	err := explain.InitFromFile("../testdata/explain12.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	top := explain.Nodes[0]
+	if top.MotionType != "Gather" || top.Senders != KnownInt(40) || top.Receivers != KnownInt(1) || top.Segments != KnownInt(40) {
+		t.Fatalf("Motion not parsed: %s %d:%d %d", top.MotionType, top.Senders, top.Receivers, top.Segments)
+	}
+
+	edges := explain.SliceGraph()
+	if len(edges) == 0 || edges[0].From != 6 || edges[0].To != 0 {
+		t.Fatalf("Expected slice6 -> slice0 first, got %v", edges)
+	}
+	if edges[1].From != 5 || edges[1].To != 6 || edges[1].Motion.MotionType != "Redistribute" {
+		t.Errorf("Expected slice5 -> slice6 Redistribute, got %v", edges[1])
+	}
+}
+
+func TestExplain_rowsIn(t *testing.T) {
+	explain := Explain{}
+	err := explain.InitFromFile("../testdata/explain05.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range explain.Nodes {
+		if n.Operator != "Hash" {
+			continue
+		}
+		if n.RowsInAvg != KnownFloat(2744500) || n.RowsInWorkers != KnownInt(2) || n.RowsInMax != KnownFloat(2755500) || n.RowsInSeg != KnownString("seg1") || n.RowsInMsEnd != KnownFloat(6893) || n.RowsInMsOffset != KnownFloat(149) {
+			t.Errorf("Rows in not parsed: %+v", n)
+		}
+		// Hash has no "Rows out" so the actual rows come from "Rows in"
+		if n.MaxRows != KnownFloat(2755500) {
+			t.Errorf("Expected max rows from Rows in, got %f", n.MaxRows)
+		}
+		return
+	}
+	t.Fatal("Hash node not found")
+}
@@ -0,0 +1,75 @@
+package plan
+
+import (
+	"regexp"
+	"strings"
+)
+
+var exprPatterns = map[string]*regexp.Regexp{
+	"LITERAL": regexp.MustCompile(`'(?:[^']|'')*'`),
+	"COLUMN":  regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_$]*(\.[A-Za-z_][A-Za-z0-9_$]*)+`),
+}
+
+// Return the qualified column references in an expression, ignoring
+// string literals and type names after "::"
+//     o.insertion_order_id::integer = d.brief_code::integer  ->  [o.insertion_order_id d.brief_code]
+//     public.sales.id = public.sales.year                     ->  [public.sales.id public.sales.year]
+func exprColumns(expr string) []string {
+	expr = exprPatterns["LITERAL"].ReplaceAllString(expr, "''")
+
+	columns := []string{}
+	seen := map[string]bool{}
+	for _, loc := range exprPatterns["COLUMN"].FindAllStringIndex(expr, -1) {
+		// Skip type names e.g. ::pg_catalog.text
+		if loc[0] >= 2 && expr[loc[0]-2:loc[0]] == "::" {
+			continue
+		}
+		column := expr[loc[0]:loc[1]]
+		if !seen[column] {
+			seen[column] = true
+			columns = append(columns, column)
+		}
+	}
+
+	return columns
+}
+
+// Columns formatted for warnings, falls back to the whole expression
+func exprColumnsString(expr string) string {
+	columns := exprColumns(expr)
+	if len(columns) == 0 {
+		return expr
+	}
+	return strings.Join(columns, ", ")
+}
+
+// Split a list of expressions on the commas which are not inside
+// brackets or quotes
+//     a, lower(b), coalesce(c, 0)  ->  [a lower(b) coalesce(c, 0)]
+func splitExprList(list string) []string {
+	exprs := []string{}
+	depth := 0
+	quoted := false
+	start := 0
+
+	for i, c := range list {
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			exprs = append(exprs, strings.TrimSpace(list[start:i]))
+			start = i + 1
+		}
+	}
+
+	if last := strings.TrimSpace(list[start:]); last != "" {
+		exprs = append(exprs, last)
+	}
+
+	return exprs
+}
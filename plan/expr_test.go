@@ -0,0 +1,38 @@
+package plan
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpr_columns(t *testing.T) {
+	tests := map[string][]string{
+		"public.sales.id = public.sales.year":                                         {"public.sales.id", "public.sales.year"},
+		"o.insertion_order_id::integer = d.brief_code::integer":                       {"o.insertion_order_id", "d.brief_code"},
+		"(ac.campaign_sc::text = 'a.b'::text) AND (x.y = x.y)":                        {"ac.campaign_sc", "x.y"},
+		"account_id::text = '1-C7-4426'::pg_catalog.text":                             {},
+		"calendar_date >= '2016-02-01'::date AND calendar_date <= '2016-02-29'::date": {},
+	}
+
+	for input, expected := range tests {
+		if columns := exprColumns(input); !reflect.DeepEqual(columns, expected) {
+			t.Errorf("%q: expected %v, got %v", input, expected, columns)
+		}
+	}
+}
+
+func TestExpr_splitList(t *testing.T) {
+	tests := map[string][]string{
+		"a":                                     {"a"},
+		"a, lower(b), coalesce(c, 0)":           {"a", "lower(b)", "coalesce(c, 0)"},
+		"hd.tori_no::text, 'x,y'::text, d DESC": {"hd.tori_no::text", "'x,y'::text", "d DESC"},
+		"(ARRAY[1, 2])[1], b":                   {"(ARRAY[1, 2])[1]", "b"},
+		"":                                      {},
+	}
+
+	for input, expected := range tests {
+		if exprs := splitExprList(input); !reflect.DeepEqual(exprs, expected) {
+			t.Errorf("%q: expected %v, got %v", input, expected, exprs)
+		}
+	}
+}
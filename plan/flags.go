@@ -0,0 +1,88 @@
+package plan
+
+import (
+	"flag"
+	"strings"
+)
+
+// Command line flags shared by the example programs
+//     -config planchecker.yaml -threshold motion_count=8 -disable spilling
+type Flags struct {
+	Config        string
+	Thresholds    []string
+	Enable        string
+	Disable       string
+	AnalyzeScript bool // Print the ANALYZE script instead of the plan
+}
+
+// Repeatable -threshold name=value
+type thresholdFlag struct {
+	values *[]string
+}
+
+func (f thresholdFlag) String() string {
+	if f.values == nil {
+		return ""
+	}
+	return strings.Join(*f.values, ",")
+}
+
+func (f thresholdFlag) Set(s string) error {
+	// Check it now so a typo is reported before the plan is read
+	t := DefaultThresholds()
+	if err := t.SetString(s); err != nil {
+		return err
+	}
+	*f.values = append(*f.values, s)
+	return nil
+}
+
+func AddFlags(fs *flag.FlagSet) *Flags {
+	f := new(Flags)
+	fs.StringVar(&f.Config, "config", "", "YAML or JSON config file with check thresholds and rules")
+	fs.Var(thresholdFlag{&f.Thresholds}, "threshold", "Set a check threshold as name=value, can be repeated.\nNames: "+strings.Join(thresholdNames, ", "))
+	fs.StringVar(&f.Enable, "enable", "", "Comma separated check IDs or categories to run, empty for all")
+	fs.StringVar(&f.Disable, "disable", "", "Comma separated check IDs or categories to skip")
+	fs.BoolVar(&f.AnalyzeScript, "analyze-script", false, "Print ANALYZE statements for the tables with stale statistics instead of the plan")
+	return f
+}
+
+// Options from the flags. Thresholds in the config file are set first so
+// -threshold can override them
+func (f *Flags) Options(opts Options) (Options, error) {
+	config := DefaultConfig()
+	if f.Config != "" {
+		var err error
+		config, err = LoadConfig(f.Config)
+		if err != nil {
+			return opts, err
+		}
+	}
+
+	for _, s := range f.Thresholds {
+		if err := config.Thresholds.SetString(s); err != nil {
+			return opts, err
+		}
+	}
+	opts.Thresholds = &config.Thresholds
+
+	registry, err := config.Registry()
+	if err != nil {
+		return opts, err
+	}
+	opts.Registry = registry
+
+	opts.EnableChecks = splitList(f.Enable)
+	opts.DisableChecks = splitList(f.Disable)
+	return opts, nil
+}
+
+func splitList(s string) []string {
+	values := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,98 @@
+package plan
+
+import (
+	"regexp"
+	"strings"
+)
+
+var joinPatterns = map[string]*regexp.Regexp{
+	// Merge Join, Merge Left Join, Merge Full Join
+	"MERGE_JOIN": regexp.MustCompile(`Merge( [A-Za-z]+)? Join`),
+	"HASH_JOIN":  regexp.MustCompile(`Hash( [A-Za-z]+)? Join`),
+	// Seq Scan on orders o, Index Scan using customers_pkey on customers c
+	"RELATION": regexp.MustCompile(` on ([A-Za-z_][A-Za-z0-9_$.]*|"[^"]+")(?: ([A-Za-z_][A-Za-z0-9_$]*|"[^"]+"))?`),
+}
+
+// The two inputs of a join. The outer input is read once, the inner
+// input is hashed for a Hash Join and scanned for each outer row by a
+// Nested Loop
+//     Hash Join
+//       ->  Seq Scan on sales        outer, probes the hash table
+//       ->  Hash                     inner, built first
+//             ->  Seq Scan on region
+// nil for nodes which are not joins
+func (n *Node) JoinInputs() (*Node, *Node) {
+	if !n.IsJoin() || len(n.SubNodes) < 2 {
+		return nil, nil
+	}
+	return n.SubNodes[0], n.SubNodes[1]
+}
+
+// Rows one process produces for one scan of the node, the actual rows if
+// analyzed. The inputs of a join run in the same processes so these can
+// be compared
+func (n *Node) RowsPerProcess() (float64, bool) {
+	if _, actual, ok := n.RowEstimate(); ok {
+		// Only the "(actual rows=N loops=N)" format is per process
+		if !n.Loops.Valid {
+			actual /= float64(n.Processes())
+		}
+		return actual, true
+	}
+	return float64(n.Rows), false
+}
+
+// Table names and aliases read by the node or the nodes below it. ORCA
+// qualifies columns with the table name, the legacy planner with the
+// alias
+//     Seq Scan on orders o  ->  [orders o]
+func (n *Node) relations() []string {
+	relations := []string{}
+	for _, s := range append([]*Node{n}, n.Descendants()...) {
+		if m := joinPatterns["RELATION"].FindStringSubmatch(s.Operator); m != nil {
+			for _, r := range m[1:] {
+				if r != "" && !containsString(relations, r) {
+					relations = append(relations, r)
+				}
+			}
+		}
+	}
+	return relations
+}
+
+// The inner input of a Nested Loop uses values from the outer row, e.g.
+// an index lookup, so it is not compared with every outer row. Only
+// conditions on columns of the outer tables count, not constants like
+// Index Cond: (status = 'A')
+//     ->  Seq Scan on orders o
+//     ->  Index Scan using customers_pkey on customers c
+//           Index Cond: (id = o.customer_id)
+func (n *Node) isParameterizedBy(outer *Node) bool {
+	relations := outer.relations()
+	for _, s := range append([]*Node{n}, n.Descendants()...) {
+		for _, cond := range []string{s.IndexCond, s.RecheckCond, s.Filter} {
+			for _, column := range exprColumns(cond) {
+				table := column[:strings.LastIndex(column, ".")]
+				for _, r := range relations {
+					// public.sales.id is a column of sales
+					if table == r || strings.HasSuffix(table, "."+r) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// A Nested Loop comparing every outer row with every inner row, with at
+// least CartesianRows comparisons per segment
+func (n *Node) isCartesianProduct(t Thresholds) bool {
+	outer, inner := n.JoinInputs()
+	if outer == nil || !patterns["NESTED_LOOP"].MatchString(n.Operator) || inner.isParameterizedBy(outer) {
+		return false
+	}
+	outerRows, _ := outer.RowsPerProcess()
+	innerRows, _ := inner.RowsPerProcess()
+	return outerRows*innerRows >= t.CartesianRows
+}
@@ -0,0 +1,117 @@
+package plan
+
+import (
+	"testing"
+)
+
+func TestNode_joinInputs(t *testing.T) {
+	explain := Explain{}
+	err := explain.InitFromFile("../testdata/explain24.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	join := explain.Nodes[1]
+	outer, inner := join.JoinInputs()
+	if outer == nil || outer.Object != "sales" || inner.Operator != "Hash" {
+		t.Fatalf("Unexpected join inputs %v %v", outer, inner)
+	}
+	if outer, _ := outer.JoinInputs(); outer != nil {
+		t.Error("Expected no join inputs for a scan")
+	}
+
+	// (actual rows=1012 loops=1) is already per process
+	if rows, analyzed := outer.RowsPerProcess(); rows != 1012 || !analyzed {
+		t.Errorf("Expected 1012 rows, got %v %v", rows, analyzed)
+	}
+}
+
+func TestCheck_hashBuildSide(t *testing.T) {
+	explain := parseFileWithOptions(t, "explain05.txt", Options{EnableChecks: []string{"hash-build-side"}})
+
+	// Hash of 5489000 sales rows probed by 5500
+	warnings := explain.AllWarnings()
+	if len(warnings) != 1 {
+		t.Fatalf("Expected 1 warning, got %v", warnings)
+	}
+	w := warnings[0]
+	if w.Params["build_rows"] != 2744500.0 || w.Params["probe_rows"] != 2750.0 {
+		t.Errorf("Unexpected params %v", w.Params)
+	}
+	if w.Resolution != "Run ANALYZE on sales so the optimizer hashes the smaller input" {
+		t.Errorf("Unexpected resolution %s", w.Resolution)
+	}
+}
+
+func TestCheck_joinStrategy(t *testing.T) {
+	explain := parseFileWithOptions(t, "explain09.txt", Options{EnableChecks: []string{"joins"}})
+
+	// Only the cartesian-product for the top Nested Loop
+	warnings := explain.AllWarnings()
+	if len(warnings) != 1 || warnings[0].CheckID != "cartesian-product" {
+		t.Fatalf("Expected 1 cartesian-product warning, got %v", warnings)
+	}
+	if warnings[0].Cause != "Cartesian product of 315844 and 2646714 rows per segment" {
+		t.Errorf("Unexpected cause %s", warnings[0].Cause)
+	}
+
+	// An index lookup for each outer row is not a cartesian product
+	thresholds := DefaultThresholds()
+	thresholds.JoinInputRows = 1
+	thresholds.CartesianRows = 1
+	explain = parseFileWithOptions(t, "explain23.txt", Options{EnableChecks: []string{"joins"}, Thresholds: &thresholds})
+	warnings = explain.AllWarnings()
+	if len(warnings) != 1 || warnings[0].CheckID != "large-join-inputs" || warnings[0].Params["outer_rows"] != 300.0 {
+		t.Errorf("Expected 1 large-join-inputs warning, got %v", warnings)
+	}
+}
+
+func TestCheck_cartesianProductConstantIndexCond(t *testing.T) {
+	// The Index Cond does not use the outer row so every order is
+	// compared with every matching customer
+	explain := parseStringWithOptions(t, `
+ Nested Loop  (cost=0.29..20000.00 rows=2000000 width=16)
+   ->  Seq Scan on orders o  (cost=0.00..1000.00 rows=2000 width=8)
+   ->  Index Scan using customers_status on customers c  (cost=0.29..8.30 rows=1000 width=8)
+         Index Cond: (status = 'A'::bpchar)
+`, Options{EnableChecks: []string{"joins"}})
+
+	warnings := explain.AllWarnings()
+	if len(warnings) != 1 || warnings[0].CheckID != "cartesian-product" {
+		t.Fatalf("Expected 1 cartesian-product warning, got %v", warnings)
+	}
+
+	outer, inner := explain.Nodes[0].JoinInputs()
+	if inner.isParameterizedBy(outer) {
+		t.Error("Expected a constant Index Cond not to be parameterized")
+	}
+}
+
+func TestCheck_joinStrategyMaterialize(t *testing.T) {
+	text := `
+ Nested Loop  (cost=0.00..6000000.00 rows=200000000 width=16)
+   Join Filter: (o.created_at > c.created_at)
+   ->  Seq Scan on orders o  (cost=0.00..1000.00 rows=20000 width=8)
+   ->  Materialize  (cost=0.00..500.00 rows=20000 width=8)
+         ->  Seq Scan on customers c  (cost=0.00..400.00 rows=20000 width=8)
+`
+	explain := parseStringWithOptions(t, text, Options{EnableChecks: []string{"joins"}})
+	warnings := explain.AllWarnings()
+	if len(warnings) != 1 || warnings[0].CheckID != "cartesian-product" || warnings[0].Params["join_filter"] != "(o.created_at > c.created_at)" {
+		t.Fatalf("Expected 1 cartesian-product warning, got %v", warnings)
+	}
+
+	// Too few comparisons for cartesian-product, large-join-inputs
+	// reports it instead
+	thresholds := DefaultThresholds()
+	thresholds.JoinInputRows = 1e4
+	thresholds.CartesianRows = 1e9
+	explain = parseStringWithOptions(t, text, Options{EnableChecks: []string{"joins"}, Thresholds: &thresholds})
+	warnings = explain.AllWarnings()
+	if len(warnings) != 1 || warnings[0].CheckID != "large-join-inputs" {
+		t.Fatalf("Expected 1 large-join-inputs warning, got %v", warnings)
+	}
+	if warnings[0].Cause != "Nested Loop compares 20000 inner rows with each of 20000 outer rows per segment" {
+		t.Errorf("Unexpected cause %s", warnings[0].Cause)
+	}
+}
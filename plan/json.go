@@ -0,0 +1,103 @@
+package plan
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ------------------------------------------------------------
+// EXPLAIN (ANALYZE, FORMAT JSON)
+// [
+//   {
+//     "Plan": {
+//       "Node Type": "Gather Motion",
+//       "Senders": 2,
+//       "Receivers": 1,
+//       "Slice": 1,
+//       "Segments": 2,
+//       "Startup Cost": 0.00,
+//       "Total Cost": 431.00,
+//       "Plan Rows": 1,
+//       "Plan Width": 8,
+//       "Plans": [ ... ]
+//     },
+//     "Settings": {"optimizer": "on"},
+//     "Optimizer": "PQO version 1.620",
+//     "Execution Time": 5.095
+//   }
+// ]
+//
+func (e *Explain) parseJSON(plantext string) error {
+	e.logDebugf("parseJSON\n")
+
+	dec := json.NewDecoder(strings.NewReader(plantext))
+	root, err := decodeJSONValue(dec)
+	if err != nil {
+		line, column := offsetPosition(plantext, dec.InputOffset())
+		return e.structuredError("JSON", plantext, Diagnostic{Line: line, Column: column, Message: err.Error()})
+	}
+
+	return e.buildStructured(root)
+}
+
+// Decode the next JSON value keeping the order of object keys
+func decodeJSONValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		// string, float64, bool or nil
+		return tok, nil
+	}
+
+	switch delim {
+	case '{':
+		m := newPropMap()
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := keyTok.(string)
+			if !ok {
+				return nil, errors.New("expected object key")
+			}
+			value, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			m.set(key, value)
+		}
+		// Consume closing "}"
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return m, nil
+
+	case '[':
+		list := []interface{}{}
+		for dec.More() {
+			value, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		// Consume closing "]"
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return list, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("unexpected %s", delim))
+}
@@ -0,0 +1,53 @@
+package plan
+
+import "testing"
+
+func TestJSON_explain02(t *testing.T) {
+	text := Explain{}
+	err := text.InitFromFile("../testdata/explain02.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	explain := Explain{}
+	err = explain.InitFromFile("../testdata/explain02.json", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if explain.Format != "json" {
+		t.Fatalf("Expected json format, got %s", explain.Format)
+	}
+
+	if len(explain.Nodes) != len(text.Nodes) {
+		t.Fatalf("Expected %d nodes, got %d", len(text.Nodes), len(explain.Nodes))
+	}
+
+	for i, n := range explain.Nodes {
+		if n.Operator != text.Nodes[i].Operator {
+			t.Errorf("Node %d operator %q, expected %q", i, n.Operator, text.Nodes[i].Operator)
+		}
+		if n.Filter != text.Nodes[i].Filter {
+			t.Errorf("Node %d filter %q, expected %q", i, n.Filter, text.Nodes[i].Filter)
+		}
+		if len(n.Warnings) != len(text.Nodes[i].Warnings) {
+			t.Errorf("Node %d has %d warnings, expected %d", i, len(n.Warnings), len(text.Nodes[i].Warnings))
+		}
+	}
+
+	if explain.Runtime != text.Runtime || explain.OptimizerStatus != text.OptimizerStatus || explain.MemoryUsed != text.MemoryUsed {
+		t.Error("Statement level fields do not match text format")
+	}
+
+	if len(explain.SliceStats) != len(text.SliceStats) {
+		t.Errorf("Expected %d slice stats, got %d", len(text.SliceStats), len(explain.SliceStats))
+	}
+}
+
+func TestJSON_invalid(t *testing.T) {
+	explain := Explain{}
+	err := explain.InitFromString(`[{"Plan": {"Node Type": "Seq Scan"`, false)
+	if err == nil {
+		t.Fatal("Expected error for truncated JSON")
+	}
+}
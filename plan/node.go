@@ -11,40 +11,80 @@ type Node struct {
 	Indent int
 	Offset int
 
+	// Lines in the input the node and its details came from, 0 if not
+	// known e.g. for structured formats
+	LineStart int
+	LineEnd   int
+
 	// Variables parsed from EXPLAIN
 	Operator    string
 	Object      string // Name of index or table. Only exists for some nodes
 	ObjectType  string // TABLE, INDEX, etc...
-	Slice       int64
+	Slice       OptionalInt
+	MotionType  string // Gather, Redistribute, Broadcast, etc... Only exists for motion nodes
+	Senders     OptionalInt
+	Receivers   OptionalInt
+	Segments    OptionalInt
 	StartupCost float64
 	TotalCost   float64
 	NodeCost    float64
-	PrctCost    float64
+	PrctCost    OptionalFloat
 	Rows        int64
 	Width       int64
 
 	// Variables parsed from EXPLAIN ANALYZE
-	ActualRows        float64
-	AvgRows           float64
-	Workers           int64
-	MaxRows           float64
-	MaxSeg            string
-	Scans             int64
-	MsFirst           float64
-	MsEnd             float64
-	MsOffset          float64
-	MsNode            float64
-	MsPrct            float64
-	AvgMem            float64
-	MaxMem            float64
-	ExecMemLine       float64
-	SpillFile         int64
-	SpillReuse        int64
-	PartSelected      int64
-	PartSelectedTotal int64
-	PartScanned       int64
-	PartScannedTotal  int64
-	Filter            string
+	ActualRows           OptionalFloat
+	AvgRows              OptionalFloat
+	Workers              OptionalInt
+	MaxRows              OptionalFloat
+	MaxSeg               OptionalString
+	Scans                OptionalInt
+	NoRowRequested       bool          // "(No row requested)", the node was not run
+	RowsInAvg            OptionalFloat // Rows in, received by the node
+	RowsInWorkers        OptionalInt
+	RowsInMax            OptionalFloat
+	RowsInSeg            OptionalString
+	RowsInMsEnd          OptionalFloat
+	RowsInMsOffset       OptionalFloat
+	Loops                OptionalInt // PostgreSQL style "loops=", time and rows are per loop
+	MsFirst              OptionalFloat
+	MsEnd                OptionalFloat
+	MsOffset             OptionalFloat
+	MsNode               OptionalFloat
+	MsPrct               OptionalFloat
+	AvgMem               OptionalFloat // Work_mem used
+	MaxMem               OptionalFloat
+	ExecMemAvg           OptionalFloat // Executor memory
+	ExecMemMax           OptionalFloat
+	ExecMemSeg           OptionalString
+	MemoryAvg            OptionalFloat // Memory (explain_memory_verbosity)
+	MemoryMax            OptionalFloat
+	MemorySeg            OptionalString
+	WorkMemWantedAvg     OptionalFloat // Work_mem wanted
+	WorkMemWantedMax     OptionalFloat
+	WorkMemWantedSeg     OptionalString
+	WorkMemWantedWorkers OptionalInt
+	SpillFile            OptionalInt
+	SpillReuse           OptionalInt
+	PartSelected         OptionalInt
+	PartSelectedTotal    OptionalInt
+	PartScanned          OptionalInt
+	PartScannedTotal     OptionalInt
+	Filter               string
+	HashCond             string
+	MergeCond            string
+	JoinFilter           string
+	IndexCond            string
+	RecheckCond          string
+	OneTimeFilter        string
+	HashKey              []string
+	SortKey              []string
+	GroupBy              []string
+	HashChainAvg         OptionalFloat // Hash chain length
+	HashChainMax         OptionalInt
+	HashBucketsUsed      OptionalInt
+	HashBuckets          OptionalInt
+	HashSeg              OptionalString
 
 	// Contains all the text lines below each node
 	ExtraInfo []string
@@ -53,43 +93,102 @@ type Node struct {
 	SubNodes []*Node
 	SubPlans []*Plan
 
+	// Populated in linkTree() once the tree is built, see tree.go
+	ID         int   // Position in Explain.Nodes, the same every time the plan is parsed
+	Depth      int   // 0 for the top node, SubPlan top nodes are one deeper than their parent
+	Parent     *Node `json:"-"` // nil for the top node
+	ParentPlan *Plan `json:"-"` // Set if this is the top node of a SubPlan
+
 	// Populated with any warning for the node
 	Warnings []Warning
 
 	// Flag to detect if we are looking at EXPLAIN or EXPLAIN ANALYZE output
 	IsAnalyzed bool
+
+	logger  Logger
+	explain *Explain // Set before the checks run
+}
+
+// Thresholds for node checks
+func (n *Node) Thresholds() Thresholds {
+	if n.explain == nil {
+		return DefaultThresholds()
+	}
+	return n.explain.Thresholds
 }
 
-// Init everything to -1
+// Reset everything parsed from the node details, values which may not
+// be in the plan are unknown until they are parsed
 func (n *Node) Init() {
-	n.ActualRows = -1
-	n.AvgRows = -1
-	n.Workers = -1
-	n.MaxRows = -1
-	n.MaxSeg = "-"
-	n.Scans = -1
-	n.MsFirst = -1
-	n.MsEnd = -1
-	n.MsOffset = -1
-	n.AvgMem = -1
-	n.MaxMem = -1
-	n.ExecMemLine = -1
-	n.SpillFile = -1
-	n.SpillReuse = -1
-	n.PartSelected = -1
-	n.PartSelectedTotal = -1
-	n.PartScanned = -1
-	n.PartScannedTotal = -1
+	n.ActualRows = OptionalFloat{}
+	n.AvgRows = OptionalFloat{}
+	n.Workers = OptionalInt{}
+	n.MaxRows = OptionalFloat{}
+	n.MaxSeg = OptionalString{}
+	n.Scans = OptionalInt{}
+	n.NoRowRequested = false
+	n.RowsInAvg = OptionalFloat{}
+	n.RowsInWorkers = OptionalInt{}
+	n.RowsInMax = OptionalFloat{}
+	n.RowsInSeg = OptionalString{}
+	n.RowsInMsEnd = OptionalFloat{}
+	n.RowsInMsOffset = OptionalFloat{}
+	n.Loops = OptionalInt{}
+	n.MsFirst = OptionalFloat{}
+	n.MsEnd = OptionalFloat{}
+	n.MsOffset = OptionalFloat{}
+	n.AvgMem = OptionalFloat{}
+	n.MaxMem = OptionalFloat{}
+	n.ExecMemAvg = OptionalFloat{}
+	n.ExecMemMax = OptionalFloat{}
+	n.ExecMemSeg = OptionalString{}
+	n.MemoryAvg = OptionalFloat{}
+	n.MemoryMax = OptionalFloat{}
+	n.MemorySeg = OptionalString{}
+	n.WorkMemWantedAvg = OptionalFloat{}
+	n.WorkMemWantedMax = OptionalFloat{}
+	n.WorkMemWantedSeg = OptionalString{}
+	n.WorkMemWantedWorkers = OptionalInt{}
+	n.SpillFile = OptionalInt{}
+	n.SpillReuse = OptionalInt{}
+	n.PartSelected = OptionalInt{}
+	n.PartSelectedTotal = OptionalInt{}
+	n.PartScanned = OptionalInt{}
+	n.PartScannedTotal = OptionalInt{}
 	n.Filter = ""
+	n.HashCond = ""
+	n.MergeCond = ""
+	n.JoinFilter = ""
+	n.IndexCond = ""
+	n.RecheckCond = ""
+	n.OneTimeFilter = ""
+	n.HashKey = []string{}
+	n.SortKey = []string{}
+	n.GroupBy = []string{}
+	n.HashChainAvg = OptionalFloat{}
+	n.HashChainMax = OptionalInt{}
+	n.HashBucketsUsed = OptionalInt{}
+	n.HashBuckets = OptionalInt{}
+	n.HashSeg = OptionalString{}
 	n.IsAnalyzed = false
 }
 
+// Time spent in the node over all loops. PostgreSQL reports the
+// average per loop so multiply it back out
+func (n *Node) MsTotal() OptionalFloat {
+	if n.Loops.Valid && n.Loops.Value > 1 {
+		return n.MsEnd.Mul(n.Loops.Float())
+	}
+	return n.MsEnd
+}
+
 func (n *Node) CalculateSubNodeDiff() {
 	msChild := 0.0
 	costChild := 0.0
 	for _, s := range n.SubNodes {
 		//logDebugf("\tSUBNODE%s", s.Operator)
-		msChild += s.MsEnd
+		// Nodes which did not run have no time to take off
+		msChild += s.MsTotal().Or(0)
 		costChild += s.TotalCost
 	}
 
@@ -98,11 +197,11 @@ func (n *Node) CalculateSubNodeDiff() {
 		costChild += s.TopNode.TotalCost
 	}
 
-	n.MsNode = n.MsEnd - msChild
+	n.MsNode = n.MsTotal().Sub(KnownFloat(msChild))
 	n.NodeCost = n.TotalCost - costChild
 
-	if n.MsNode < 0 {
-		n.MsNode = 0
+	if n.MsNode.Valid && n.MsNode.Value < 0 {
+		n.MsNode = KnownFloat(0)
 	}
 
 	if n.NodeCost < 0 {
@@ -110,9 +209,10 @@ func (n *Node) CalculateSubNodeDiff() {
 	}
 }
 
-func (n *Node) CalculatePercentage(totalCost float64, totalMs float64) {
-	n.PrctCost = n.NodeCost / totalCost * 100
-	n.MsPrct = n.MsNode / totalMs * 100
+// Percentages are unknown when the total is unknown or 0
+func (n *Node) CalculatePercentage(totalCost float64, totalMs OptionalFloat) {
+	n.PrctCost = KnownFloat(n.NodeCost).Div(KnownFloat(totalCost)).Mul(KnownFloat(100))
+	n.MsPrct = n.MsNode.Div(totalMs).Mul(KnownFloat(100))
 }
 
 // Render node for output to console
@@ -120,7 +220,7 @@ func (n *Node) Render(indent int) {
 	indent += 1
 	indentString := strings.Repeat(" ", indent*indentDepth)
 
-	if n.Slice > -1 {
+	if n.Slice.Valid {
 		fmt.Printf("\n%s   // Slice %d\n", indentString, n.Slice)
 	}
 
@@ -132,6 +232,16 @@ func (n *Node) Render(indent int) {
 		n.Rows,
 		n.Width)
 
+	// PostgreSQL style actual stats are part of the node line so are not in ExtraInfo
+	if n.Loops.Valid {
+		fmt.Printf("%s   actual time %.3f..%.3f | rows %.0f | loops %d\n",
+			indentString,
+			n.MsFirst,
+			n.MsEnd,
+			n.ActualRows,
+			n.Loops)
+	}
+
 	// Render ExtraInfo
 	for _, e := range n.ExtraInfo[1:] {
 		fmt.Printf("%s   %s\n", indentString, strings.Trim(e, " "))
@@ -140,7 +250,7 @@ func (n *Node) Render(indent int) {
 	// Render warnings
 	for _, w := range n.Warnings {
 		fmt.Printf("\x1b[%dm", warningColor)
-		fmt.Printf("%s   WARNING: %s | %s\n", indentString, w.Cause, w.Resolution)
+		fmt.Printf("%s   %s\n", indentString, w)
 		fmt.Printf("\x1b[%dm", 0)
 	}
 
@@ -0,0 +1,211 @@
+package plan
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Plans are often pasted straight from a psql session or pgAdmin so
+// contain text which is not part of the plan:
+//     analytics=> explain analyze select count(*) from sales;
+//                          QUERY PLAN
+//     ------------------------------------------------------------------
+//      Aggregate  (cost=0.00..431.00 rows=1 width=8)                  +
+//        ->  Gather Motion 2:1  (slice1; segments: 2)  (cost=...)     +
+//     (2 rows)
+//
+//     Time: 12.345 ms
+// normaliseText() removes it before the lines are parsed
+var normalisePatterns = map[string]*regexp.Regexp{
+	"PROMPT":       regexp.MustCompile(`^[A-Za-z0-9_]+[=\-('"][#>]`),
+	"ROWCOUNT":     regexp.MustCompile(`^\s*\([0-9]+ rows?\)\s*$`),
+	"TIMING":       regexp.MustCompile(`^Time: [0-9.]+ ms`),
+	"CONTINUATION": regexp.MustCompile(`\s+\+$`),
+	"WRAPPED":      regexp.MustCompile(`\.$`),
+	"HEADER":       regexp.MustCompile(`^\s*QUERY PLAN\s*$`),
+	"DASHES":       regexp.MustCompile(`^\s*-+\s*$`),
+}
+
+// A change made to the input, reported so it is clear why the parsed
+// plan does not match the text exactly
+type Normalisation struct {
+	Line   int    // Line number in the original input, 0 for the whole input
+	Action string // What was changed
+	Text   string // Original text
+}
+
+func (n Normalisation) String() string {
+	if n.Line == 0 {
+		return n.Action
+	}
+	return fmt.Sprintf("Line %d: %s: %s", n.Line, n.Action, strings.TrimSpace(n.Text))
+}
+
+// Clean up the lines of a text plan
+//     CRLF line endings          -> LF
+//     tabs                       -> spaces (8 column tab stops)
+//     "pgAdmin quoted line"      -> unquoted, indented by 1 like psql
+//     psql prompts               -> removed along with the query
+//     (15 rows) and Time: 12 ms  -> removed
+//     trailing " +" markers      -> removed
+//     psql wrapped lines         -> joined back together
+//     terminal wrapped lines     -> joined back together
+//     Greenplum 6/7 memory units -> Greenplum 4/5 units, see normaliseDialectLine()
+//
+// Also returns the original line number of each line in the result and
+// the dialect, see dialectFound.dialect(). Everything is done in one
+// pass as plans can have many thousands of lines
+func normaliseText(lines []string) ([]string, []int, []Normalisation, string) {
+	result := make([]string, 0, len(lines))
+	numbers := make([]int, 0, len(lines))
+	changes := []Normalisation{}
+	crlf := false
+	inPlan := false
+	found := dialectFound{}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		number := i + 1
+
+		if strings.HasSuffix(line, "\r") {
+			line = strings.TrimRight(line, "\r")
+			crlf = true
+		}
+
+		// Prompts are followed by the query, which is not needed
+		if normalisePatterns["PROMPT"].MatchString(line) {
+			changes = append(changes, Normalisation{number, "Removed psql prompt", line})
+			inPlan = false
+			continue
+		}
+
+		if isRowCount(line) {
+			changes = append(changes, Normalisation{number, "Removed row count", line})
+			inPlan = false
+			continue
+		}
+
+		if normalisePatterns["TIMING"].MatchString(line) {
+			changes = append(changes, Normalisation{number, "Removed psql timing", line})
+			continue
+		}
+
+		if strings.Contains(line, "\t") {
+			changes = append(changes, Normalisation{number, "Expanded tabs", line})
+			line = expandTabs(line)
+		}
+
+		trimmed := strings.TrimRight(line, " ")
+		if len(trimmed) > 1 && trimmed[:1] == `"` && trimmed[len(trimmed)-1:] == `"` {
+			// Add a space so the output matches standard psql output
+			changes = append(changes, Normalisation{number, "Removed pgAdmin quotes", line})
+			line = " " + strings.Replace(trimmed[1:len(trimmed)-1], `""`, `"`, -1)
+		}
+
+		if strings.HasSuffix(line, "+") && normalisePatterns["CONTINUATION"].MatchString(line) {
+			changes = append(changes, Normalisation{number, "Removed psql line continuation", line})
+			line = normalisePatterns["CONTINUATION"].ReplaceAllString(line, "")
+		}
+
+		// psql wrapped format ends a wrapped line with "." and starts
+		// the rest of it on the next line with "."
+		for i+1 < len(lines) && strings.HasPrefix(lines[i+1], ".") && normalisePatterns["WRAPPED"].MatchString(line) {
+			i++
+			changes = append(changes, Normalisation{i + 1, "Rejoined wrapped line", lines[i]})
+			line = line[:len(line)-1] + strings.TrimRight(lines[i][1:], "\r")
+		}
+
+		// Terminals wrap long lines at their width so the rest of a node
+		// line or its details starts in column 1, without the space psql
+		// puts in front of every line of the plan
+		if inPlan && isTerminalWrapped(line) && strings.HasPrefix(result[len(result)-1], " ") {
+			changes = append(changes, Normalisation{number, "Rejoined wrapped line", line})
+			result[len(result)-1] += line
+			continue
+		}
+
+		if isNodeLine(line) {
+			inPlan = true
+		}
+		found.add(line)
+		result = append(result, normaliseDialectLine(line))
+		numbers = append(numbers, number)
+	}
+
+	if crlf {
+		changes = append([]Normalisation{{0, "Converted CRLF line endings", ""}}, changes...)
+	}
+
+	return result, numbers, changes, found.dialect()
+}
+
+// psql shows EXPLAIN (FORMAT JSON|XML|YAML) in the same layout as a
+// text plan, with the structured plan indented by 1 and " +" at the end
+// of each line
+//                QUERY PLAN
+//     -----------------------------------
+//      [                                +
+//        {                              +
+//          "Plan": {                    +
+//     ...
+//     (1 row)
+// Takes the lines from normaliseText() and returns the structured plan
+// without the psql layout, ok is false if the text is not a structured
+// plan
+func unwrapStructured(lines []string, numbers []int) (string, []Normalisation, bool) {
+	changes := []Normalisation{}
+	result := []string{}
+	for i, line := range lines {
+		if normalisePatterns["HEADER"].MatchString(line) || normalisePatterns["DASHES"].MatchString(line) {
+			changes = append(changes, Normalisation{numbers[i], "Removed psql header", line})
+			continue
+		}
+		// Text plans are found from the first line of the plan so
+		// they are not copied
+		if len(result) == 0 && strings.TrimSpace(line) != "" && detectFormat(line) == "text" {
+			return "", nil, false
+		}
+		result = append(result, strings.TrimPrefix(line, " "))
+	}
+
+	structured := strings.Join(result, "\n")
+	if detectFormat(structured) == "text" {
+		return "", nil, false
+	}
+	return structured, changes, true
+}
+
+// Text which is not in column 1 of a psql plan
+func isTerminalWrapped(line string) bool {
+	if line == "" || line[:1] == " " {
+		return false
+	}
+	return !normalisePatterns["HEADER"].MatchString(line) && !normalisePatterns["DASHES"].MatchString(line)
+}
+
+// psql footer, e.g. "(15 rows)"
+func isRowCount(line string) bool {
+	trimmed := strings.TrimRight(line, " \t\r")
+	if !strings.HasSuffix(trimmed, " row)") && !strings.HasSuffix(trimmed, " rows)") {
+		return false
+	}
+	return normalisePatterns["ROWCOUNT"].MatchString(line)
+}
+
+// Replace tabs with spaces up to the next 8 column tab stop
+func expandTabs(line string) string {
+	var b strings.Builder
+	column := 0
+	for _, c := range line {
+		if c == '\t' {
+			spaces := 8 - column%8
+			b.WriteString(strings.Repeat(" ", spaces))
+			column += spaces
+			continue
+		}
+		b.WriteRune(c)
+		column++
+	}
+	return b.String()
+}
@@ -0,0 +1,144 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalise_psqlSession(t *testing.T) {
+	input := []string{
+		"analytics=> explain analyze select count(*)\r",
+		"analytics-> from sales;\r",
+		"                     QUERY PLAN\r",
+		"--------------------------------------------------\r",
+		" Aggregate  (cost=0.00..431.00 rows=1 width=8)   +\r",
+		"\t->  Seq Scan on sales  (cost=0.00..431.00 rows=1 width=8)\r",
+		"(2 rows)\r",
+		"\r",
+		"Time: 12.345 ms\r",
+	}
+
+	expected := []string{
+		"                     QUERY PLAN",
+		"--------------------------------------------------",
+		" Aggregate  (cost=0.00..431.00 rows=1 width=8)",
+		"        ->  Seq Scan on sales  (cost=0.00..431.00 rows=1 width=8)",
+		"",
+	}
+
+	lines, numbers, changes, _ := normaliseText(input)
+	if !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", strings.Join(expected, "\n"), strings.Join(lines, "\n"))
+	}
+
+	if !reflect.DeepEqual(numbers, []int{3, 4, 5, 6, 8}) {
+		t.Errorf("Expected original line numbers, got %v", numbers)
+	}
+
+	actions := []string{}
+	for _, c := range changes {
+		actions = append(actions, c.Action)
+	}
+	expectedActions := []string{
+		"Converted CRLF line endings",
+		"Removed psql prompt",
+		"Removed psql prompt",
+		"Removed psql line continuation",
+		"Expanded tabs",
+		"Removed row count",
+		"Removed psql timing",
+	}
+	if !reflect.DeepEqual(actions, expectedActions) {
+		t.Errorf("Expected %v, got %v", expectedActions, actions)
+	}
+}
+
+func TestNormalise_pgAdminAndWrapped(t *testing.T) {
+	input := []string{
+		`"Seq Scan on sales  (cost=0.00..431.00 rows=1 width=8)"`,
+		`"  Filter: (name = ""a"")"`,
+		"   Rows out:  1 rows with 0.1 ms to first row, 0.2 ms to end, start offset by 1..",
+		".5 ms.",
+	}
+
+	lines, _, _, _ := normaliseText(input)
+	expected := []string{
+		" Seq Scan on sales  (cost=0.00..431.00 rows=1 width=8)",
+		`   Filter: (name = "a")`,
+		"   Rows out:  1 rows with 0.1 ms to first row, 0.2 ms to end, start offset by 1.5 ms.",
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected:\n%s\nGot:\n%s", strings.Join(expected, "\n"), strings.Join(lines, "\n"))
+	}
+}
+
+func TestNormalise_plan(t *testing.T) {
+	explain := Explain{}
+	err := explain.InitFromFile("../testdata/explain12.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(explain.Normalisations) == 0 || explain.Normalisations[0].Action != "Removed psql prompt" {
+		t.Errorf("Expected psql prompt to be removed, got %v", explain.Normalisations)
+	}
+}
+
+// psql shows EXPLAIN (FORMAT JSON) with the text layout around it
+func TestNormalise_psqlStructured(t *testing.T) {
+	for _, file := range []string{"explain06.json", "explain06.yaml", "explain06.xml"} {
+		data, err := ioutil.ReadFile("../testdata/" + file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+
+		psql := []string{"analytics=> explain (format json) select * from pg_class;", "               QUERY PLAN", "-----------------------------------------"}
+		for i, line := range lines {
+			line = fmt.Sprintf(" %-40s ", line)
+			if i < len(lines)-1 {
+				line += "+"
+			}
+			psql = append(psql, line)
+		}
+		psql = append(psql, "(1 row)", "")
+
+		plain := Explain{}
+		if err := plain.InitFromFile("../testdata/"+file, false); err != nil {
+			t.Fatal(err)
+		}
+
+		explains, err := ParseAll(context.Background(), strings.NewReader(strings.Join(psql, "\n")), Options{})
+		if err != nil {
+			t.Fatalf("%s: %s", file, err)
+		}
+		explain := explains[0]
+		if len(explains) != 1 || explain.Format != plain.Format || len(explain.Nodes) != len(plain.Nodes) {
+			t.Errorf("%s: expected %d %s nodes, got %d %s", file, len(plain.Nodes), plain.Format, len(explain.Nodes), explain.Format)
+		}
+		if len(explain.Normalisations) == 0 || explain.Normalisations[0].Action != "Removed psql prompt" {
+			t.Errorf("%s: expected the psql layout to be removed, got %v", file, explain.Normalisations)
+		}
+	}
+}
+
+// The Hash Cond on line 8 was wrapped by a 207 column terminal
+func TestNormalise_terminalWrapped(t *testing.T) {
+	explain := Explain{}
+	err := explain.InitFromFile("../testdata/explain15.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(explain.Diagnostics) != 0 {
+		t.Errorf("Expected no diagnostics, got %v", explain.Diagnostics)
+	}
+
+	if !strings.HasSuffix(explain.Nodes[1].HashCond, "|| lpad(cc.creative_sc::text, 10, '0'::text)) || lpad(cc.creative_version::text, 10, '0'::text))") {
+		t.Errorf("Expected the wrapped Hash Cond to be rejoined, got %q", explain.Nodes[1].HashCond)
+	}
+}
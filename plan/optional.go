@@ -0,0 +1,213 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Values which are not always in the plan, e.g. the actual rows and
+// times are only there for EXPLAIN ANALYZE and only for nodes which ran.
+// The zero value is unknown which is printed as "-" and written to JSON
+// as null.
+//     n.MsEnd.Valid                  false until parsed
+//     fmt.Sprintf("%.0f", n.MsEnd)   "-" if unknown
+//     n.MsEnd.Sub(n.MsFirst)         unknown if either is unknown
+type OptionalFloat struct {
+	Value float64
+	Valid bool
+}
+
+type OptionalInt struct {
+	Value int64
+	Valid bool
+}
+
+type OptionalString struct {
+	Value string
+	Valid bool
+}
+
+func KnownFloat(v float64) OptionalFloat {
+	return OptionalFloat{v, true}
+}
+
+func KnownInt(v int64) OptionalInt {
+	return OptionalInt{v, true}
+}
+
+func KnownString(v string) OptionalString {
+	return OptionalString{v, true}
+}
+
+// Unknown if the text is not a number
+func parseOptionalFloat(s string) OptionalFloat {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return OptionalFloat{}
+	}
+	return KnownFloat(v)
+}
+
+func parseOptionalInt(s string) OptionalInt {
+	v, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return OptionalInt{}
+	}
+	return KnownInt(v)
+}
+
+// The value or def if unknown
+func (o OptionalFloat) Or(def float64) float64 {
+	if o.Valid {
+		return o.Value
+	}
+	return def
+}
+
+func (o OptionalInt) Or(def int64) int64 {
+	if o.Valid {
+		return o.Value
+	}
+	return def
+}
+
+func (o OptionalString) Or(def string) string {
+	if o.Valid {
+		return o.Value
+	}
+	return def
+}
+
+// Arithmetic is unknown if any of the values are unknown
+func (o OptionalFloat) Add(v OptionalFloat) OptionalFloat {
+	if !o.Valid || !v.Valid {
+		return OptionalFloat{}
+	}
+	return KnownFloat(o.Value + v.Value)
+}
+
+func (o OptionalFloat) Sub(v OptionalFloat) OptionalFloat {
+	if !o.Valid || !v.Valid {
+		return OptionalFloat{}
+	}
+	return KnownFloat(o.Value - v.Value)
+}
+
+func (o OptionalFloat) Mul(v OptionalFloat) OptionalFloat {
+	if !o.Valid || !v.Valid {
+		return OptionalFloat{}
+	}
+	return KnownFloat(o.Value * v.Value)
+}
+
+// Also unknown when dividing by zero instead of Inf/NaN
+func (o OptionalFloat) Div(v OptionalFloat) OptionalFloat {
+	if !o.Valid || !v.Valid || v.Value == 0 {
+		return OptionalFloat{}
+	}
+	return KnownFloat(o.Value / v.Value)
+}
+
+func (o OptionalInt) Float() OptionalFloat {
+	return OptionalFloat{float64(o.Value), o.Valid}
+}
+
+func (o OptionalFloat) String() string {
+	return fmt.Sprint(o)
+}
+
+func (o OptionalInt) String() string {
+	return fmt.Sprint(o)
+}
+
+func (o OptionalString) String() string {
+	return o.Or("-")
+}
+
+// Implements fmt.Formatter so the usual verbs work on the value, e.g.
+// "%.0f" or "%d", and unknown values are printed as "-"
+func (o OptionalFloat) Format(f fmt.State, verb rune) {
+	formatOptional(f, verb, o.Value, o.Valid)
+}
+
+func (o OptionalInt) Format(f fmt.State, verb rune) {
+	formatOptional(f, verb, o.Value, o.Valid)
+}
+
+func formatOptional(f fmt.State, verb rune, value interface{}, valid bool) {
+	width := ""
+	if w, ok := f.Width(); ok {
+		width = strconv.Itoa(w)
+	}
+	flags := ""
+	for _, flag := range "+-# 0" {
+		// %+v on a struct passes "+" down to the fields
+		if flag == '+' && verb == 'v' {
+			continue
+		}
+		if f.Flag(int(flag)) {
+			flags += string(flag)
+		}
+	}
+
+	if !valid {
+		fmt.Fprintf(f, "%"+flags+width+"s", "-")
+		return
+	}
+
+	precision := ""
+	if p, ok := f.Precision(); ok {
+		precision = "." + strconv.Itoa(p)
+	}
+	fmt.Fprintf(f, "%"+flags+width+precision+string(verb), value)
+}
+
+func (o OptionalFloat) MarshalJSON() ([]byte, error) {
+	if !o.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.Value)
+}
+
+func (o OptionalInt) MarshalJSON() ([]byte, error) {
+	if !o.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.Value)
+}
+
+func (o OptionalString) MarshalJSON() ([]byte, error) {
+	if !o.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.Value)
+}
+
+func (o *OptionalFloat) UnmarshalJSON(data []byte) error {
+	*o = OptionalFloat{}
+	if string(data) == "null" {
+		return nil
+	}
+	o.Valid = true
+	return json.Unmarshal(data, &o.Value)
+}
+
+func (o *OptionalInt) UnmarshalJSON(data []byte) error {
+	*o = OptionalInt{}
+	if string(data) == "null" {
+		return nil
+	}
+	o.Valid = true
+	return json.Unmarshal(data, &o.Value)
+}
+
+func (o *OptionalString) UnmarshalJSON(data []byte) error {
+	*o = OptionalString{}
+	if string(data) == "null" {
+		return nil
+	}
+	o.Valid = true
+	return json.Unmarshal(data, &o.Value)
+}
@@ -0,0 +1,75 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestOptional_arithmetic(t *testing.T) {
+	if v := KnownFloat(5).Sub(KnownFloat(2)); v != KnownFloat(3) {
+		t.Errorf("Expected 3, got %v", v)
+	}
+	if v := KnownFloat(5).Sub(OptionalFloat{}); v.Valid {
+		t.Errorf("Expected unknown, got %v", v)
+	}
+	if v := (OptionalFloat{}).Add(KnownFloat(1)); v.Valid {
+		t.Errorf("Expected unknown, got %v", v)
+	}
+	if v := KnownFloat(5).Div(KnownFloat(0)); v.Valid {
+		t.Errorf("Expected unknown for divide by zero, got %v", v)
+	}
+	if v := KnownInt(4).Float().Mul(KnownFloat(0.5)); v != KnownFloat(2) {
+		t.Errorf("Expected 2, got %v", v)
+	}
+}
+
+func TestOptional_format(t *testing.T) {
+	tests := []struct {
+		format string
+		value  interface{}
+		want   string
+	}{
+		{"%.2f", KnownFloat(1.234), "1.23"},
+		{"%.2f", OptionalFloat{}, "-"},
+		{"%5d", KnownInt(42), "   42"},
+		{"%5d", OptionalInt{}, "    -"},
+		{"%s", OptionalString{}, "-"},
+		{"%+v", struct{ A OptionalInt }{KnownInt(1)}, "{A:1}"},
+	}
+
+	for _, test := range tests {
+		if got := fmt.Sprintf(test.format, test.value); got != test.want {
+			t.Errorf("%s: expected %q, got %q", test.format, test.want, got)
+		}
+	}
+}
+
+func TestOptional_json(t *testing.T) {
+	explain := Explain{}
+	err := explain.InitFromFile("../testdata/explain01.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Not EXPLAIN ANALYZE so there are no actual rows or times
+	data, err := json.Marshal(explain.Nodes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["ActualRows"] != nil || fields["MsEnd"] != nil {
+		t.Errorf("Expected null ActualRows and MsEnd, got %v and %v", fields["ActualRows"], fields["MsEnd"])
+	}
+
+	var v OptionalFloat
+	if err := json.Unmarshal([]byte("1.5"), &v); err != nil || v != KnownFloat(1.5) {
+		t.Errorf("Expected 1.5, got %v %v", v, err)
+	}
+	if err := json.Unmarshal([]byte("null"), &v); err != nil || v.Valid {
+		t.Errorf("Expected unknown, got %v %v", v, err)
+	}
+}
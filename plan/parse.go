@@ -0,0 +1,262 @@
+package plan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+// Anything with Printf, e.g. *log.Logger
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Options for Parse and ParseAll. The zero value detects everything
+// and has no limits
+type Options struct {
+	Logger   Logger // Debug output, nil for none
+	Dialect  string // gpdb5, gpdb6, gpdb7, postgres. Empty to detect from the text
+	Lenient  bool   // See Explain.Lenient
+	MaxBytes int64  // Maximum size of the input, 0 for no limit
+	MaxLines int    // Maximum number of lines in the input, 0 for no limit
+
+	// Checks to run, DefaultRegistry if nil. Enable and Disable are
+	// lists of check IDs or categories, when Enable is empty all checks
+	// are run except those in Disable
+	Registry      *Registry
+	EnableChecks  []string
+	DisableChecks []string
+
+	// Limits used by the checks, DefaultThresholds() if nil
+	Thresholds *Thresholds
+}
+
+var dialects = map[string]bool{
+	"gpdb5":    true,
+	"gpdb6":    true,
+	"gpdb7":    true,
+	"postgres": true,
+}
+
+// Parse a single plan from r. Safe to call from many goroutines as all
+// state is kept in the returned Explain
+//     explain, err := plan.Parse(ctx, os.Stdin, plan.Options{Lenient: true})
+func Parse(ctx context.Context, r io.Reader, opts Options) (*Explain, error) {
+	plantext, err := readPlanText(ctx, r, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	e := new(Explain)
+	e.setOptions(ctx, opts)
+	err = e.InitPlan(plantext)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Parse every plan in r, e.g. a psql session log with several EXPLAIN
+// statements. Each plan gets its own Explain with its own warnings.
+// Line numbers in Diagnostics and Normalisations are relative to the
+// whole input
+func ParseAll(ctx context.Context, r io.Reader, opts Options) ([]*Explain, error) {
+	plantext, err := readPlanText(ctx, r, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := splitPlans(plantext)
+	explains := []*Explain{}
+	failed := []Diagnostic{}
+	var firstErr error
+	lineStart := 0
+
+	for i, chunk := range chunks {
+		e := new(Explain)
+		e.setOptions(ctx, opts)
+		err := e.InitPlan(chunk)
+
+		e.shiftLines(lineStart)
+
+		if err != nil {
+			d, ok := err.(Diagnostic)
+			if !ok {
+				d = Diagnostic{Severity: DiagnosticError, Message: err.Error()}
+			}
+			if d.Line > 0 {
+				d.Line += lineStart
+			}
+			if len(chunks) > 1 {
+				d.Message = fmt.Sprintf("Plan %d of %d: %s", i+1, len(chunks), d.Message)
+			}
+
+			if ok {
+				err = d
+			} else if len(chunks) > 1 {
+				err = errors.New(d.Message)
+			}
+
+			// Lenient mode keeps the other plans, the failure is added
+			// to the Diagnostics of the next plan which parsed
+			if !opts.Lenient || e.context().Err() != nil {
+				return nil, err
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			// The first line of the plan which is not blank
+			if d.Line == 0 {
+				d.Line = lineStart + 1
+				for _, l := range strings.Split(chunk, "\n") {
+					if strings.TrimSpace(l) != "" {
+						break
+					}
+					d.Line++
+				}
+			}
+			failed = append(failed, d)
+		} else {
+			e.Diagnostics = append(failed, e.Diagnostics...)
+			failed = []Diagnostic{}
+			explains = append(explains, e)
+		}
+		lineStart += strings.Count(chunk, "\n") + 1
+	}
+
+	if len(failed) > 0 {
+		if len(explains) == 0 {
+			return nil, firstErr
+		}
+		last := explains[len(explains)-1]
+		last.Diagnostics = append(last.Diagnostics, failed...)
+	}
+
+	return explains, nil
+}
+
+// Make line numbers relative to the whole input when the plan started
+// at lineStart. 0 means not known so is left as it is
+func (e *Explain) shiftLines(lineStart int) {
+	shift := func(line *int) {
+		if *line > 0 {
+			*line += lineStart
+		}
+	}
+
+	for d := range e.Diagnostics {
+		shift(&e.Diagnostics[d].Line)
+	}
+	for n := range e.Normalisations {
+		shift(&e.Normalisations[n].Line)
+	}
+	for _, n := range e.Nodes {
+		shift(&n.LineStart)
+		shift(&n.LineEnd)
+		for w := range n.Warnings {
+			shift(&n.Warnings[w].LineStart)
+			shift(&n.Warnings[w].LineEnd)
+		}
+	}
+	for w := range e.Warnings {
+		shift(&e.Warnings[w].LineStart)
+		shift(&e.Warnings[w].LineEnd)
+	}
+}
+
+// InitPlan can be called without Parse so there may be no context
+func (e *Explain) context() context.Context {
+	if e.ctx == nil {
+		return context.Background()
+	}
+	return e.ctx
+}
+
+func (e *Explain) setOptions(ctx context.Context, opts Options) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	e.ctx = ctx
+	e.logger = opts.Logger
+	e.Lenient = opts.Lenient
+	e.Dialect = opts.Dialect
+	e.registry = opts.Registry
+	e.enableChecks = opts.EnableChecks
+	e.disableChecks = opts.DisableChecks
+	e.thresholds = opts.Thresholds
+}
+
+// Read the whole input checking the options and limits
+func readPlanText(ctx context.Context, r io.Reader, opts Options) (string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if opts.Dialect != "" && !dialects[opts.Dialect] {
+		return "", errors.New(fmt.Sprintf("Unknown dialect %s", opts.Dialect))
+	}
+
+	registry := opts.Registry
+	if registry == nil {
+		registry = DefaultRegistry
+	}
+	if err := registry.validateNames(append(opts.EnableChecks, opts.DisableChecks...)); err != nil {
+		return "", err
+	}
+
+	if opts.MaxBytes > 0 {
+		// Read one extra byte to know if the limit was exceeded
+		r = io.LimitReader(r, opts.MaxBytes+1)
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	if opts.MaxBytes > 0 && int64(len(data)) > opts.MaxBytes {
+		return "", errors.New(fmt.Sprintf("Plan is larger than the limit of %d bytes", opts.MaxBytes))
+	}
+
+	plantext := string(data)
+
+	if opts.MaxLines > 0 {
+		lines := strings.Count(plantext, "\n")
+		if !strings.HasSuffix(plantext, "\n") {
+			lines++
+		}
+		if lines > opts.MaxLines {
+			return "", errors.New(fmt.Sprintf("Plan has more than the limit of %d lines", opts.MaxLines))
+		}
+	}
+
+	return plantext, ctx.Err()
+}
+
+// Options used by the Init* helpers, debug output goes to stdout
+func initOptions(debug bool, lenient bool) Options {
+	opts := Options{Lenient: lenient}
+	if debug {
+		opts.Logger = log.New(os.Stdout, "", 0)
+	}
+	return opts
+}
+
+// Reuse the receiver so the Init* helpers keep working as before
+func (e *Explain) initFromReader(r io.Reader, debug bool) error {
+	parsed, err := Parse(context.Background(), r, initOptions(debug, e.Lenient))
+	if parsed != nil {
+		*e = *parsed
+	}
+	return err
+}
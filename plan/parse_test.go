@@ -0,0 +1,137 @@
+package plan
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParse_reader(t *testing.T) {
+	data, err := ioutil.ReadFile("../testdata/explain05.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	explain, err := Parse(context.Background(), bytes.NewReader(data), Options{Logger: log.New(&buf, "", 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(explain.Nodes) == 0 || explain.Dialect != "gpdb5" {
+		t.Fatalf("Plan not parsed, %d nodes dialect %q", len(explain.Nodes), explain.Dialect)
+	}
+
+	if !strings.Contains(buf.String(), "createNode") {
+		t.Error("Expected debug output to go to the logger")
+	}
+}
+
+func TestParse_concurrent(t *testing.T) {
+	files := []string{"explain01.txt", "explain05.txt", "explain12.txt", "explain23.txt", "explain02.json"}
+
+	expected := map[string]int{}
+	for _, f := range files {
+		explain := Explain{}
+		if err := explain.InitFromFile("../testdata/"+f, false); err != nil {
+			t.Fatal(err)
+		}
+		expected[f] = len(explain.Nodes)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan string, len(files)*10)
+	for i := 0; i < 10; i++ {
+		for _, f := range files {
+			wg.Add(1)
+			go func(f string) {
+				defer wg.Done()
+				explain := Explain{}
+				if err := explain.InitFromFile("../testdata/"+f, false); err != nil {
+					errs <- err.Error()
+				} else if len(explain.Nodes) != expected[f] {
+					errs <- f
+				}
+			}(f)
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for e := range errs {
+		t.Error(e)
+	}
+}
+
+func TestParse_options(t *testing.T) {
+	input := " Seq Scan on a  (cost=0.00..1.00 rows=1 width=4)\n   Filter: x = 1\n"
+
+	if _, err := Parse(context.Background(), strings.NewReader(input), Options{MaxBytes: 10}); err == nil {
+		t.Error("Expected size limit error")
+	}
+
+	if _, err := Parse(context.Background(), strings.NewReader(input), Options{MaxLines: 1}); err == nil {
+		t.Error("Expected line limit error")
+	}
+
+	if _, err := Parse(context.Background(), strings.NewReader(input), Options{MaxLines: 2}); err != nil {
+		t.Errorf("Expected 2 lines to be within the limit: %s", err)
+	}
+
+	if _, err := Parse(context.Background(), strings.NewReader(input), Options{Dialect: "oracle"}); err == nil {
+		t.Error("Expected unknown dialect error")
+	}
+
+	explain, err := Parse(context.Background(), strings.NewReader(input), Options{Dialect: "gpdb6"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if explain.Dialect != "gpdb6" {
+		t.Errorf("Expected dialect gpdb6, got %q", explain.Dialect)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Parse(ctx, strings.NewReader(input), Options{}); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestParse_allLenient(t *testing.T) {
+	// The second plan has lost the indentation of its only node
+	input := strings.Join([]string{
+		"analytics=> explain select * from a;",
+		" Seq Scan on a  (cost=0.00..431.00 rows=1 width=8)",
+		"(1 row)",
+		"",
+		"analytics=> explain select * from b;",
+		"->  Seq Scan on b  (cost=0.00..431.00 rows=1 width=8)",
+		"(1 row)",
+		"",
+		"analytics=> explain select * from c;",
+		" Seq Scan on c  (cost=0.00..431.00 rows=1 width=8)",
+		"(1 row)",
+	}, "\n")
+
+	if _, err := ParseAll(context.Background(), strings.NewReader(input), Options{}); err == nil {
+		t.Fatal("Expected an error without Lenient")
+	}
+
+	explains, err := ParseAll(context.Background(), strings.NewReader(input), Options{Lenient: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(explains) != 2 || explains[0].Nodes[0].Operator != "Seq Scan on a" || explains[1].Nodes[0].Operator != "Seq Scan on c" {
+		t.Fatalf("Expected plans a and c, got %d plans", len(explains))
+	}
+
+	// Recorded on the plan after the one which failed
+	d := explains[1].Diagnostics
+	if len(d) != 1 || d[0].Severity != DiagnosticError || d[0].Line != 5 || !strings.HasPrefix(d[0].Message, "Plan 2 of 3: ") {
+		t.Errorf("Unexpected diagnostics %v", d)
+	}
+}
@@ -1,23 +1,332 @@
 package plan
 
-import "regexp"
+import (
+	"regexp"
+	"strings"
+)
 
 var patterns = map[string]*regexp.Regexp{
 	"NODE":    regexp.MustCompile(`(.*) \((cost=(.*)\.\.(.*) ){0,1}rows=(.*) width=(.*)\)`),
 	"SLICE":   regexp.MustCompile(`(.*)  \(slice([0-9]*)`),
 	"SUBPLAN": regexp.MustCompile(` SubPlan `),
 
+	"MOTION":   regexp.MustCompile(`^(.*) Motion ([0-9]+):([0-9]+)`),
+	"SEGMENTS": regexp.MustCompile(`\(slice[0-9]+; segments: ([0-9]+)\)`),
+	"ROWSIN":   regexp.MustCompile(`^\s*Rows in: `),
+
+	"ACTUAL":         regexp.MustCompile(` *\(actual (time=([0-9.]+)\.\.([0-9.]+) ){0,1}rows=([0-9.]+) loops=([0-9]+)\)`),
+	"NEVER_EXECUTED": regexp.MustCompile(` *\(never executed\)`),
+
 	"SLICESTATS":   regexp.MustCompile(` Slice statistics:`),
 	"SLICESTATS_1": regexp.MustCompile(`\((slice[0-9]{1,})\).*Executor memory: ([0-9]{1,})K bytes`),
 	"SLICESTATS_2": regexp.MustCompile(`avg x ([0-9]+) workers, ([0-9]+)K bytes max \((seg[0-9]+)\)\.`),
 	"SLICESTATS_3": regexp.MustCompile(`Work_mem: ([0-9]+)K bytes max.`),
 	"SLICESTATS_4": regexp.MustCompile(`([0-9]+)K bytes wanted.`),
+	"SLICESTATS_5": regexp.MustCompile(`^\(slice[0-9]+\)\s+\*`),
 
 	"STATEMENTSTATS":        regexp.MustCompile(` Statement statistics:`),
-	"STATEMENTSTATS_USED":   regexp.MustCompile(`Memory used: ([0-9.-]{1,})K bytes`),
-	"STATEMENTSTATS_WANTED": regexp.MustCompile(`Memory wanted: ([0-9.-]{1,})K bytes`),
+	"STATEMENTSTATS_USED":   regexp.MustCompile(`Memory used:\s+([0-9.-]{1,})K bytes`),
+	"STATEMENTSTATS_WANTED": regexp.MustCompile(`Memory wanted:\s+([0-9.-]{1,})K bytes`),
 
 	"SETTINGS":  regexp.MustCompile(` Settings: `),
 	"OPTIMIZER": regexp.MustCompile(` Optimizer status: `),
 	"RUNTIME":   regexp.MustCompile(` Total runtime: `),
+
+	// Greenplum 6/7 and PostgreSQL
+	"SLICESTATS_LINE": regexp.MustCompile(`^\s+\(slice[0-9]+\)\s+.*Executor memory:`),
+	"MEMORY":          regexp.MustCompile(`^\s?Memory (used|wanted): `),
+	"OPTIMIZER_NAME":  regexp.MustCompile(`^\s?Optimizer: `),
+	"PLANNINGTIME":    regexp.MustCompile(`^\s?Planning [Tt]ime: ([0-9.]+) ms`),
+	"EXECUTIONTIME":   regexp.MustCompile(`^\s?Execution [Tt]ime: ([0-9.]+) ms`),
+	"SETTING_QUOTED":  regexp.MustCompile(`([A-Za-z0-9_.]+) = '((?:[^']|'')*)'`),
+
+	// Optimizer status values
+	//     Optimizer status: PQO version 1.620
+	//     Optimizer: Pivotal Optimizer (GPORCA) version 3.83.0
+	//     Optimizer status: legacy query optimizer
+	//     Optimizer: Postgres query optimizer
+	"OPTIMIZER_ORCA":   regexp.MustCompile(`PQO|GPORCA`),
+	"OPTIMIZER_LEGACY": regexp.MustCompile(`legacy query optimizer|Postgres query optimizer|Postgres-based planner`),
+
+	// Node details, see parseNodeDetails()
+	"ROWS_AVG_WORKERS":       regexp.MustCompile(`Avg (\S+) rows x (\d+) workers`),
+	"ROWSIN_MAX":             regexp.MustCompile(`(Max |Rows in:\s+)(\S+) rows \((seg\d+)\)`),
+	"ROWS_MS_END":            regexp.MustCompile(` (\S+) ms to end`),
+	"ROWS_MS_OFFSET":         regexp.MustCompile(`start offset by (\S+) ms`),
+	"OBJECT_TABLE":           regexp.MustCompile(`(Index ){0,0} Scan (on|using) (\S+)`),
+	"OBJECT_INDEX":           regexp.MustCompile(`Index.*Scan (on|using) (\S+)`),
+	"ROWS":                   regexp.MustCompile(`ms to end`),
+	"ROWS_DESTINATION":       regexp.MustCompile(`(\d+) rows at destination`),
+	"ROWS_WITH":              regexp.MustCompile(`(\d+) rows with \S+ ms`),
+	"ROWS_MAX":               regexp.MustCompile(`Max (\S+) rows`),
+	"ROWS_MS_FIRST":          regexp.MustCompile(` (\S+) ms to first row`),
+	"ROWS_AVG":               regexp.MustCompile(`Avg (\S+) `),
+	"ROWS_WORKERS":           regexp.MustCompile(` x (\d+) workers`),
+	"ROWS_SCANS":             regexp.MustCompile(`of (\d+) scans`),
+	"ROWS_SEG":               regexp.MustCompile(` \((seg\d+)\) `),
+	"ROWS_MAX_SEG":           regexp.MustCompile(`Max (\S+) rows \(`),
+	"ROWS_SEG_ROWS":          regexp.MustCompile(` (\S+) rows \(`),
+	"NO_ROW_REQUESTED":       regexp.MustCompile(`\(No row requested\)`),
+	"WORKMEM":                regexp.MustCompile(`Work_mem used`),
+	"WORKMEM_AVG":            regexp.MustCompile(`Work_mem used:\s+(\d+)K bytes avg`),
+	"WORKMEM_MAX":            regexp.MustCompile(`\s+(\d+)K bytes max`),
+	"SPILL":                  regexp.MustCompile(`\((\d+) spilling,\s+(\d+) reused\)`),
+	"PART_SELECTED":          regexp.MustCompile(`Partitions selected:  (\d+) \(out of (\d+)\)`),
+	"PART_SCANNED":           regexp.MustCompile(`Partitions scanned:  (Avg ){0,}(.*) \(out of (\d+)\)`),
+	"FILTER":                 regexp.MustCompile(`^\s*(\S+ ){0,1}Filter: (.*)`),
+	"CONDITION":              regexp.MustCompile(`^\s*(Hash Cond|Merge Cond|Join Filter|Index Cond|Recheck Cond|One-Time Filter|Hash Key|Sort Key|Group By|Group Key): (.*)`),
+	"HASH_CHAIN":             regexp.MustCompile(`Hash chain length ([0-9.]+) avg, (\d+) max, using (\d+) of (\d+) buckets`),
+	"HASH_CHAIN_SEG":         regexp.MustCompile(`\((seg\d+)\)\s+Hash chain`),
+	"EXECMEM":                regexp.MustCompile(`Executor memory:\s+(\d+)K bytes`),
+	"NODE_MEMORY":            regexp.MustCompile(`^\s*Memory:\s+(\d+)K bytes`),
+	"WORKMEM_WANTED":         regexp.MustCompile(`Work_mem wanted:\s+(\d+)K bytes`),
+	"WORKMEM_WANTED_WORKERS": regexp.MustCompile(`affecting (\d+) workers`),
+	"MEMORY_MAX":             regexp.MustCompile(`^ avg, (\d+)K bytes max \((seg\d+)\)`),
+
+	// Checks
+	"SCAN_OPERATOR":      regexp.MustCompile(`(Dynamic Table|Table|Parquet table|Bitmap Index|Bitmap Append-Only Row-Oriented|Seq) Scan`),
+	"NESTED_LOOP":        regexp.MustCompile(`Nested Loop`),
+	"JOIN":               regexp.MustCompile(`(Nested Loop|\bJoin\b)`),
+	"APPEND":             regexp.MustCompile(`Append`),
+	"PARTITION_SELECTOR": regexp.MustCompile(`Partition Selector`),
+	"DYNAMIC_TABLE_SCAN": regexp.MustCompile(`Dynamic Table Scan`),
+	"FUNCTION_CALL":      regexp.MustCompile(`\S+\(.*\) `),
+	"MOTION_DATA":        regexp.MustCompile(`(Broadcast|Redistribute) Motion`),
+	"SETTING_ENABLE":     regexp.MustCompile(`enable_`),
+	"PARTITION_CHILD":    regexp.MustCompile(`_[0-9]+_prt_`),
+}
+
+// Text which is always in a line matched by the pattern, one of them
+// for patterns with alternatives. Most lines do not match most patterns
+// and strings.Contains is much faster than running the regexp, which
+// matters for plans with thousands of nodes
+var patternLiterals = map[string][]string{
+	"NODE":                   {" width="},
+	"SLICE":                  {"  (slice"},
+	"MOTION":                 {" Motion "},
+	"SEGMENTS":               {"; segments: "},
+	"ROWSIN":                 {"Rows in: "},
+	"ACTUAL":                 {"(actual "},
+	"NEVER_EXECUTED":         {"(never executed)"},
+	"OPTIMIZER_NAME":         {"Optimizer: "},
+	"PLANNINGTIME":           {"Planning "},
+	"EXECUTIONTIME":          {"Execution "},
+	"MEMORY":                 {"Memory "},
+	"SLICESTATS_LINE":        {"Executor memory:"},
+	"ROWSIN_MAX":             {" rows (seg"},
+	"ROWS_MS_END":            {" ms to end"},
+	"ROWS_MS_OFFSET":         {"start offset by "},
+	"OBJECT_TABLE":           {" Scan "},
+	"OBJECT_INDEX":           {"Index"},
+	"ROWS_DESTINATION":       {" rows at destination"},
+	"ROWS_WITH":              {" rows with "},
+	"ROWS_MAX":               {"Max "},
+	"ROWS_MS_FIRST":          {" ms to first row"},
+	"ROWS_AVG":               {"Avg "},
+	"ROWS_WORKERS":           {" workers"},
+	"ROWS_SCANS":             {" scans"},
+	"ROWS_SEG":               {" (seg"},
+	"ROWS_MAX_SEG":           {"Max "},
+	"ROWS_SEG_ROWS":          {" rows ("},
+	"NO_ROW_REQUESTED":       {"(No row requested)"},
+	"WORKMEM_AVG":            {"Work_mem used:"},
+	"WORKMEM_MAX":            {"K bytes max"},
+	"SPILL":                  {" spilling,"},
+	"FILTER":                 {"Filter: "},
+	"CONDITION":              {" Cond: ", "Join Filter: ", "One-Time Filter: ", " Key: ", "Group By: "},
+	"HASH_CHAIN_SEG":         {"Hash chain"},
+	"NODE_MEMORY":            {"Memory:"},
+	"MEMORY_MAX":             {"K bytes max ("},
+	"JOIN":                   {"Nested Loop", "Join"},
+	"SUBPLAN":                {" SubPlan "},
+	"SLICESTATS":             {" Slice statistics:"},
+	"STATEMENTSTATS":         {" Statement statistics:"},
+	"SETTINGS":               {" Settings: "},
+	"OPTIMIZER":              {" Optimizer status: "},
+	"RUNTIME":                {" Total runtime: "},
+	"ROWS":                   {"ms to end"},
+	"WORKMEM":                {"Work_mem used"},
+	"EXECMEM":                {"Executor memory:"},
+	"WORKMEM_WANTED":         {"Work_mem wanted:"},
+	"SCAN_OPERATOR":          {" Scan"},
+	"MOTION_DATA":            {" Motion"},
+	"PARTITION_CHILD":        {"_prt_"},
+	"PART_SELECTED":          {"Partitions selected:  "},
+	"PART_SCANNED":           {"Partitions scanned:  "},
+	"HASH_CHAIN":             {"Hash chain length "},
+	"WORKMEM_WANTED_WORKERS": {"affecting "},
+}
+
+// Patterns which are one word between two pieces of text, e.g.
+// `Max (\S+) rows`. Patterns starting with (\S+) make the regexp try
+// every position in the line, these are found with strings.Index
+// instead
+type wordPattern struct {
+	Before string // Text before the word, "" or " " to find the word back from After
+	Prefix string // Start of the word
+	After  string // Text after the word
+	Then   string // If set After is followed by another word and Then
+	Digits bool   // \d+ instead of \S+
+}
+
+var wordPatterns = map[string]wordPattern{
+	"ROWS_MS_END":      {Before: " ", After: " ms to end"},
+	"ROWS_MS_OFFSET":   {Before: "start offset by ", After: " ms"},
+	"ROWS_DESTINATION": {After: " rows at destination", Digits: true},
+	"ROWS_WITH":        {After: " rows with ", Then: " ms", Digits: true},
+	"ROWS_MAX":         {Before: "Max ", After: " rows"},
+	"ROWS_MS_FIRST":    {Before: " ", After: " ms to first row"},
+	"ROWS_AVG":         {Before: "Avg ", After: " "},
+	"ROWS_WORKERS":     {Before: " x ", After: " workers", Digits: true},
+	"ROWS_SCANS":       {Before: "of ", After: " scans", Digits: true},
+	"ROWS_SEG":         {Before: " (", Prefix: "seg", After: ") ", Digits: true},
+	"ROWS_MAX_SEG":     {Before: "Max ", After: " rows ("},
+	"ROWS_SEG_ROWS":    {Before: " ", After: " rows ("},
+}
+
+// \s in a regexp
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
+func (w wordPattern) isWord(c byte) bool {
+	if w.Digits {
+		return c >= '0' && c <= '9'
+	}
+	return !isSpace(c)
+}
+
+// End of Then after the word starting at i, -1 if it is not there
+func (w wordPattern) then(line string, i int) int {
+	if w.Then == "" {
+		return i
+	}
+	end := i
+	for end < len(line) && !isSpace(line[end]) {
+		end++
+	}
+	if end == i || !strings.HasPrefix(line[end:], w.Then) {
+		return -1
+	}
+	return end + len(w.Then)
+}
+
+// Same result as the regexp for the first match in the line
+func (w wordPattern) find(line string) []string {
+	if w.Before == "" || w.Before == " " {
+		for offset := 0; ; {
+			i := strings.Index(line[offset:], w.After)
+			if i == -1 {
+				return nil
+			}
+			end := offset + i
+			offset = end + 1
+
+			start := end
+			for start > 0 && w.isWord(line[start-1]) {
+				start--
+			}
+			if start == end || w.Before == " " && (start == 0 || line[start-1] != ' ') {
+				continue
+			}
+			if stop := w.then(line, end+len(w.After)); stop > -1 {
+				return []string{line[start-len(w.Before) : stop], line[start:end]}
+			}
+		}
+	}
+
+	for offset := 0; ; {
+		i := strings.Index(line[offset:], w.Before)
+		if i == -1 {
+			return nil
+		}
+		matchStart := offset + i
+		start := matchStart + len(w.Before)
+		offset = matchStart + 1
+
+		if !strings.HasPrefix(line[start:], w.Prefix) {
+			continue
+		}
+		end := start + len(w.Prefix)
+		for end < len(line) && w.isWord(line[end]) {
+			end++
+		}
+		if end == start+len(w.Prefix) || !strings.HasPrefix(line[end:], w.After) {
+			continue
+		}
+		if stop := w.then(line, end+len(w.After)); stop > -1 {
+			return []string{line[matchStart:stop], line[start:end]}
+		}
+	}
+}
+
+// Same result as patterns["FILTER"], at most one word before "Filter: "
+//     Filter: (s.amount > 100)
+//     Join Filter: (s.amount > r.limit)
+func findFilterPattern(line string) []string {
+	trimmed := strings.TrimLeft(line, " \t\n\f\r")
+	word := 0
+	for word < len(trimmed) && !isSpace(trimmed[word]) {
+		word++
+	}
+	if word > 0 && word < len(trimmed) && trimmed[word] == ' ' && strings.HasPrefix(trimmed[word+1:], "Filter: ") {
+		return []string{line, trimmed[:word+1], trimmed[word+1+len("Filter: "):]}
+	}
+	if strings.HasPrefix(trimmed, "Filter: ") {
+		return []string{line, "", trimmed[len("Filter: "):]}
+	}
+	return nil
+}
+
+// Same result as patterns["CONDITION"]
+//     Hash Cond: (s.region_id = r.id)
+func findConditionPattern(line string) []string {
+	trimmed := strings.TrimLeft(line, " \t\n\f\r")
+	for _, name := range conditionNames {
+		if strings.HasPrefix(trimmed, name) && strings.HasPrefix(trimmed[len(name):], ": ") {
+			return []string{line, name, trimmed[len(name)+2:]}
+		}
+	}
+	return nil
+}
+
+var conditionNames = []string{"Hash Cond", "Merge Cond", "Join Filter", "Index Cond", "Recheck Cond", "One-Time Filter", "Hash Key", "Sort Key", "Group By", "Group Key"}
+
+// Same as patterns[name].MatchString(line) but skips the regexp when
+// the line can not match
+func matchPattern(name string, line string) bool {
+	if !containsLiteral(line, patternLiterals[name]) {
+		return false
+	}
+	return patterns[name].MatchString(line)
+}
+
+// Same as patterns[name].FindStringSubmatch(line) but skips the regexp
+// when the line can not match. nil unless the pattern matches, otherwise
+// there is an entry for every group
+func findPattern(name string, line string) []string {
+	if !containsLiteral(line, patternLiterals[name]) {
+		return nil
+	}
+
+	switch name {
+	case "FILTER":
+		return findFilterPattern(line)
+	case "CONDITION":
+		return findConditionPattern(line)
+	}
+	if w, ok := wordPatterns[name]; ok {
+		return w.find(line)
+	}
+	return patterns[name].FindStringSubmatch(line)
+}
+
+// True if the line contains any of the literals, or there are none
+func containsLiteral(line string, literals []string) bool {
+	for _, literal := range literals {
+		if strings.Contains(line, literal) {
+			return true
+		}
+	}
+	return len(literals) == 0
 }
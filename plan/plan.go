@@ -3,7 +3,6 @@ package plan
 import (
 	"errors"
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 )
@@ -14,34 +13,89 @@ type Plan struct {
 	Indent  int
 	Offset  int
 	TopNode *Node
+	Parent  *Node `json:"-"` // Node the SubPlan belongs to, nil for the top level plan
 }
 
-// Warnings get added to the overall Explain object or a Node object
+// Warnings get added to the overall Explain object or a Node object.
+// Checks only need to set Cause, Resolution and Params, the rest is
+// filled in after the check runs
 type Warning struct {
-	Cause      string // What caused the warning
-	Resolution string // What should be done to resolve it
+	Cause      string        // What caused the warning
+	Resolution string        // What should be done to resolve it
+	Params     WarningParams // Measured values and thresholds, e.g. {"measured": 12, "threshold": 5}
+	CheckID    string        // Check which raised it
+	Severity   string        // info, warning, critical
+	Node       *Node         `json:"-"` // nil for warnings about the whole plan
+	NodeID     OptionalInt   // Node.ID, unknown for warnings about the whole plan
+	LineStart  int           // Lines in the input the warning is about, 0 if not known
+	LineEnd    int
+	DocURL     string // More about the check and how to fix it
+}
+
+type WarningParams map[string]interface{}
+
+// WARNING, CRITICAL or INFO
+func (w Warning) Label() string {
+	if w.Severity == "" {
+		return "WARNING"
+	}
+	return strings.ToUpper(w.Severity)
+}
+
+// Where the warning came from e.g. "data-skew, lines 12-14"
+func (w Warning) Source() string {
+	source := []string{}
+	if w.CheckID != "" {
+		source = append(source, w.CheckID)
+	}
+	if w.LineStart > 0 && w.LineEnd > w.LineStart {
+		source = append(source, fmt.Sprintf("lines %d-%d", w.LineStart, w.LineEnd))
+	} else if w.LineStart > 0 {
+		source = append(source, fmt.Sprintf("line %d", w.LineStart))
+	}
+	return strings.Join(source, ", ")
+}
+
+func (w Warning) String() string {
+	s := fmt.Sprintf("%s: %s | %s", w.Label(), w.Cause, w.Resolution)
+	if source := w.Source(); source != "" {
+		s += fmt.Sprintf(" (%s)", source)
+	}
+	return s
 }
 
 // Slice stats parsed from EXPLAIN ANALYZE output
+//   (slice2)  * Executor memory: 205132K bytes avg x 2 workers, 205136K bytes max (seg0).  Work_mem: 127501K bytes max, 171875K bytes wanted.
+// All memory values are in K bytes. Values not in the line are unknown
 type SliceStat struct {
-	Name          string
-	MemoryAvg     int64
-	Workers       int64
-	MemoryMax     int64
-	WorkMem       int64
-	WorkMemWanted int64
+	Name          string      // slice2
+	Slice         OptionalInt // 2
+	MemoryAvg     OptionalInt
+	Workers       OptionalInt
+	MemoryMax     OptionalInt
+	MaxSeg        OptionalString // seg0, unknown for the QD slice
+	WorkMem       OptionalInt
+	WorkMemWanted OptionalInt
+	IsConstrained bool   // Marked with "*" as work_mem was not enough
+	Line          string // Original text
 }
 
 var (
-	logDebug     bool
 	indentDepth  = 4  // Used for printing the plan
 	warningColor = 31 // RED
 
 )
 
-func logDebugf(format string, v ...interface{}) {
-	if logDebug == true {
-		fmt.Printf(format, v...)
+// Debug output goes to the logger passed in Options, if any
+func (e *Explain) logDebugf(format string, v ...interface{}) {
+	if e.logger != nil {
+		e.logger.Printf(format, v...)
+	}
+}
+
+func (n *Node) logDebugf(format string, v ...interface{}) {
+	if n.logger != nil {
+		n.logger.Printf(format, v...)
 	}
 }
 
@@ -63,7 +117,20 @@ func parseNodeExtraInfo(n *Node) error {
 	//     ->  Broadcast Motion 1:2  (slice1)  (cost=0.00..27.48 rows=1124 width=208)
 	line := n.ExtraInfo[0]
 
-	groups := patterns["NODE"].FindStringSubmatch(line)
+	// PostgreSQL and Greenplum 7 put the actual stats on the node line
+	// Example:
+	//     ->  Seq Scan on a  (cost=0.00..1.04 rows=4 width=4) (actual time=0.006..0.007 rows=4 loops=3)
+	// Remove them so the NODE pattern only sees the estimates
+	actual := findPattern("ACTUAL", line)
+	if len(actual) > 0 {
+		line = strings.Replace(line, actual[0], "", 1)
+	}
+	neverExecuted := matchPattern("NEVER_EXECUTED", line)
+	if neverExecuted {
+		line = patterns["NEVER_EXECUTED"].ReplaceAllString(line, "")
+	}
+
+	groups := findNodePattern(line)
 
 	n.Object = ""
 	n.ObjectType = ""
@@ -73,32 +140,17 @@ func parseNodeExtraInfo(n *Node) error {
 		groups[1] = strings.Trim(groups[1], " ->")
 
 		// Check if the string contains slice information
-		sliceGroups := patterns["SLICE"].FindStringSubmatch(groups[1])
+		sliceGroups := findPattern("SLICE", groups[1])
 		if len(sliceGroups) == 3 {
 			n.Operator = strings.TrimSpace(sliceGroups[1])
-			n.Slice, _ = strconv.ParseInt(strings.TrimSpace(sliceGroups[2]), 10, 64)
+			n.Slice = parseOptionalInt(sliceGroups[2])
 			// Else it's just the operator
 		} else {
 			n.Operator = strings.TrimSpace(groups[1])
-			n.Slice = -1
-		}
-
-		// Try to get object name if this is a scan node
-		// Look for non index scans
-		re := regexp.MustCompile(`(Index ){0,0} Scan (on|using) (\S+)`)
-		temp := re.FindStringSubmatch(n.Operator)
-		if len(temp) == re.NumSubexp()+1 {
-			n.Object = temp[3]
-			n.ObjectType = "TABLE"
+			n.Slice = OptionalInt{}
 		}
 
-		// Look for index scans
-		re = regexp.MustCompile(`Index.*Scan (on|using) (\S+)`)
-		temp = re.FindStringSubmatch(n.Operator)
-		if len(temp) == re.NumSubexp()+1 {
-			n.Object = temp[2]
-			n.ObjectType = "INDEX"
-		}
+		parseNodeObject(n)
 
 		// Store the remaining params
 		n.StartupCost, _ = strconv.ParseFloat(strings.TrimSpace(groups[3]), 64)
@@ -111,216 +163,456 @@ func parseNodeExtraInfo(n *Node) error {
 	}
 
 	n.Init()
+	parseNodeMotion(n, line)
+
+	if len(actual) > 0 {
+		parseNodeActual(n, actual)
+	} else if neverExecuted {
+		n.IsAnalyzed = true
+		n.ActualRows = KnownFloat(0)
+		n.Loops = KnownInt(0)
+		n.MsFirst = KnownFloat(0)
+		n.MsEnd = KnownFloat(0)
+	}
 
-	// Parse the remaining lines
-	var re *regexp.Regexp
+	parseNodeDetails(n)
+
+	return nil
+}
+
+// Same result as findPattern("NODE", line) for the usual layout of a
+// node line, anything else is left to the regexp. The NODE pattern
+// starts with (.*) so is by far the slowest part of parsing a big plan.
+//     ->  Hash Join  (cost=0.00..862.00 rows=1 width=16)
+//     ->  Hash Join  (rows=1 width=16)
+func findNodePattern(line string) []string {
+	if !containsLiteral(line, patternLiterals["NODE"]) {
+		return nil
+	}
+
+	start := strings.LastIndex(line, " (")
+	if start == -1 {
+		return nil
+	}
+
+	groups := make([]string, 7)
+	groups[0] = strings.TrimRight(line, " ")
+	groups[1] = line[:start]
+	rest := groups[0][start+2:]
+
+	if strings.HasPrefix(rest, "cost=") {
+		end := strings.Index(rest, " ")
+		if end == -1 {
+			return findPattern("NODE", line)
+		}
+		costs := strings.Split(rest[len("cost="):end], "..")
+		if len(costs) != 2 || !isNumber(costs[0], true) || !isNumber(costs[1], true) {
+			return findPattern("NODE", line)
+		}
+		groups[2] = rest[:end+1]
+		groups[3] = costs[0]
+		groups[4] = costs[1]
+		rest = rest[end+1:]
+	}
+
+	values := strings.Split(strings.TrimPrefix(strings.TrimSuffix(rest, ")"), "rows="), " width=")
+	if !strings.HasPrefix(rest, "rows=") || !strings.HasSuffix(rest, ")") || len(values) != 2 || !isNumber(values[0], false) || !isNumber(values[1], false) {
+		return findPattern("NODE", line)
+	}
+	groups[5] = values[0]
+	groups[6] = values[1]
+
+	return groups
+}
+
+func isNodeLine(line string) bool {
+	return findNodePattern(line) != nil
+}
+
+// Digits, and dots between them if decimal is set
+func isNumber(s string, decimal bool) bool {
+	if s == "" || strings.Contains(s, "..") || s[0] == '.' || s[len(s)-1] == '.' {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c != '.' || decimal == false) {
+			return false
+		}
+	}
+	return true
+}
+
+// Store the groups matched by patterns["ACTUAL"]
+// Time and rows are the average per loop, same as PostgreSQL
+//     (actual time=0.010..5.2 rows=100 loops=3)
+//     (actual rows=100 loops=3)
+func parseNodeActual(n *Node, groups []string) {
+	n.IsAnalyzed = true
+
+	if groups[1] != "" {
+		if s, err := strconv.ParseFloat(groups[2], 64); err == nil {
+			n.MsFirst = KnownFloat(s)
+		}
+		if s, err := strconv.ParseFloat(groups[3], 64); err == nil {
+			n.MsEnd = KnownFloat(s)
+		}
+	}
+
+	if s, err := strconv.ParseFloat(groups[4], 64); err == nil {
+		n.ActualRows = KnownFloat(s)
+	}
+
+	if s, err := strconv.ParseInt(groups[5], 10, 64); err == nil {
+		n.Loops = KnownInt(s)
+	}
+
+	n.logDebugf("Actual %f..%f rows %f loops %d\n", n.MsFirst, n.MsEnd, n.ActualRows, n.Loops)
+}
+
+// Get the motion details from the node line
+//     ->  Redistribute Motion 320:320  (slice14; segments: 320)  (cost=...)
+// Senders/Receivers/Segments are unknown if not in the line
+func parseNodeMotion(n *Node, line string) {
+	n.MotionType = ""
+	n.Senders = OptionalInt{}
+	n.Receivers = OptionalInt{}
+	n.Segments = OptionalInt{}
+
+	m := findPattern("MOTION", n.Operator)
+	if len(m) == 4 {
+		n.MotionType = m[1]
+		n.Senders = parseOptionalInt(m[2])
+		n.Receivers = parseOptionalInt(m[3])
+		n.logDebugf("Motion %s %d:%d\n", n.MotionType, n.Senders, n.Receivers)
+	}
+
+	m = findPattern("SEGMENTS", line)
+	if len(m) == 2 {
+		n.Segments = parseOptionalInt(m[1])
+		n.logDebugf("Segments %d\n", n.Segments)
+	}
+}
+
+// Store the receive side stats of a node, e.g. rows received by a Hash
+//     Rows in:  Avg 2744500.0 rows x 2 workers.  Max 2755500 rows (seg1) with 6893 ms to end, start offset by 149 ms.
+//     Rows in:  11000 rows (seg0) with 6893 ms to end, start offset by 149 ms.
+func parseNodeRowsIn(n *Node, line string) {
+	m := findPattern("ROWS_AVG_WORKERS", line)
+	if m != nil {
+		n.RowsInAvg = parseOptionalFloat(m[1])
+		n.RowsInWorkers = parseOptionalInt(m[2])
+	}
+
+	m = findPattern("ROWSIN_MAX", line)
+	if m != nil {
+		n.RowsInMax = parseOptionalFloat(m[2])
+		n.RowsInSeg = KnownString(m[3])
+	}
+
+	m = findPattern("ROWS_MS_END", line)
+	if m != nil {
+		n.RowsInMsEnd = parseOptionalFloat(m[1])
+	}
+
+	m = findPattern("ROWS_MS_OFFSET", line)
+	if m != nil {
+		n.RowsInMsOffset = parseOptionalFloat(m[1])
+	}
+
+	n.logDebugf("RowsIn %f x %d max %f (%s) %f ms\n", n.RowsInAvg, n.RowsInWorkers, n.RowsInMax, n.RowsInSeg, n.RowsInMsEnd)
+}
+
+// Try to get object name if this is a scan node
+func parseNodeObject(n *Node) {
+	// Look for non index scans
+	temp := findPattern("OBJECT_TABLE", n.Operator)
+	if temp != nil {
+		n.Object = temp[3]
+		n.ObjectType = "TABLE"
+	}
+
+	// Look for index scans
+	temp = findPattern("OBJECT_INDEX", n.Operator)
+	if temp != nil {
+		n.Object = temp[2]
+		n.ObjectType = "INDEX"
+	}
+}
+
+// Parse the lines below the node line. Split out from parseNodeExtraInfo
+// so the structured formats (JSON etc...) can reuse it on the lines they
+// generate for each node.
+func parseNodeDetails(n *Node) {
 	var m []string
 
 	for _, line := range n.ExtraInfo[1:] {
-		logDebugf("%s\n", line)
+		n.logDebugf("%s\n", line)
+
+		// ROWS IN
+		// Also handled by ROWS below as nodes like Hash only have "Rows in"
+		if matchPattern("ROWSIN", line) {
+			parseNodeRowsIn(n, line)
+		}
 
 		// ROWS
-		re = regexp.MustCompile(`ms to end`)
-		if re.MatchString(line) {
+		if matchPattern("ROWS", line) {
 			n.IsAnalyzed = true
-			re = regexp.MustCompile(`(\d+) rows at destination`)
-			m := re.FindStringSubmatch(line)
-			if len(m) == re.NumSubexp()+1 {
+			m := findPattern("ROWS_DESTINATION", line)
+			if m != nil {
 				if s, err := strconv.ParseFloat(m[1], 64); err == nil {
-					n.ActualRows = s
-					logDebugf("ActualRows %f\n", n.ActualRows)
+					n.ActualRows = KnownFloat(s)
+					n.logDebugf("ActualRows %f\n", n.ActualRows)
 				}
 			}
 
-			re = regexp.MustCompile(`(\d+) rows with \S+ ms`)
-			m = re.FindStringSubmatch(line)
-			if len(m) == re.NumSubexp()+1 {
+			m = findPattern("ROWS_WITH", line)
+			if m != nil {
 				if s, err := strconv.ParseFloat(m[1], 64); err == nil {
-					n.ActualRows = s
-					logDebugf("ActualRows %f\n", n.ActualRows)
+					n.ActualRows = KnownFloat(s)
+					n.logDebugf("ActualRows %f\n", n.ActualRows)
 				}
 			}
 
-			re = regexp.MustCompile(`Max (\S+) rows`)
-			m = re.FindStringSubmatch(line)
-			if len(m) == re.NumSubexp()+1 {
+			m = findPattern("ROWS_MAX", line)
+			if m != nil {
 				if s, err := strconv.ParseFloat(m[1], 64); err == nil {
-					n.MaxRows = s
-					logDebugf("MaxRows %f\n", n.MaxRows)
+					n.MaxRows = KnownFloat(s)
+					n.logDebugf("MaxRows %f\n", n.MaxRows)
 				}
 			}
 
-			re = regexp.MustCompile(` (\S+) ms to first row`)
-			m = re.FindStringSubmatch(line)
-			if len(m) == re.NumSubexp()+1 {
+			m = findPattern("ROWS_MS_FIRST", line)
+			if m != nil {
 				if s, err := strconv.ParseFloat(m[1], 64); err == nil {
-					n.MsFirst = s
-					logDebugf("MsFirst %f\n", n.MsFirst)
+					n.MsFirst = KnownFloat(s)
+					n.logDebugf("MsFirst %f\n", n.MsFirst)
 				}
 			}
 
-			re = regexp.MustCompile(` (\S+) ms to end`)
-			m = re.FindStringSubmatch(line)
-			if len(m) == re.NumSubexp()+1 {
+			m = findPattern("ROWS_MS_END", line)
+			if m != nil {
 				if s, err := strconv.ParseFloat(m[1], 64); err == nil {
-					n.MsEnd = s
-					logDebugf("MsEnd %f\n", n.MsEnd)
+					n.MsEnd = KnownFloat(s)
+					n.logDebugf("MsEnd %f\n", n.MsEnd)
 				}
 			}
 
-			re = regexp.MustCompile(`start offset by (\S+) ms`)
-			m = re.FindStringSubmatch(line)
-			if len(m) == re.NumSubexp()+1 {
+			m = findPattern("ROWS_MS_OFFSET", line)
+			if m != nil {
 				if s, err := strconv.ParseFloat(m[1], 64); err == nil {
-					n.MsOffset = s
-					logDebugf("MsOffset %f\n", n.MsOffset)
+					n.MsOffset = KnownFloat(s)
+					n.logDebugf("MsOffset %f\n", n.MsOffset)
 				}
 			}
 
-			re = regexp.MustCompile(`Avg (\S+) `)
-			m = re.FindStringSubmatch(line)
-			if len(m) == re.NumSubexp()+1 {
+			m = findPattern("ROWS_AVG", line)
+			if m != nil {
 				if s, err := strconv.ParseFloat(m[1], 64); err == nil {
-					n.AvgRows = s
-					logDebugf("AvgRows %f\n", n.AvgRows)
+					n.AvgRows = KnownFloat(s)
+					n.logDebugf("AvgRows %f\n", n.AvgRows)
 				}
 			}
 
-			re = regexp.MustCompile(` x (\d+) workers`)
-			m = re.FindStringSubmatch(line)
-			if len(m) == re.NumSubexp()+1 {
+			m = findPattern("ROWS_WORKERS", line)
+			if m != nil {
 				if s, err := strconv.ParseInt(m[1], 10, 64); err == nil {
-					n.Workers = s
-					logDebugf("Workers %d\n", n.Workers)
+					n.Workers = KnownInt(s)
+					n.logDebugf("Workers %d\n", n.Workers)
 				}
 			}
 
-			re = regexp.MustCompile(`of (\d+) scans`)
-			m = re.FindStringSubmatch(line)
-			if len(m) == re.NumSubexp()+1 {
+			if matchPattern("NO_ROW_REQUESTED", line) {
+				n.NoRowRequested = true
+			}
+
+			m = findPattern("ROWS_SCANS", line)
+			if m != nil {
 				if s, err := strconv.ParseInt(m[1], 10, 64); err == nil {
-					n.Scans = s
-					logDebugf("Scans %d\n", n.Scans)
+					n.Scans = KnownInt(s)
+					n.logDebugf("Scans %d\n", n.Scans)
 				}
 			}
 
-			re = regexp.MustCompile(` \((seg\d+)\) `)
-			m = re.FindStringSubmatch(line)
-			if len(m) == re.NumSubexp()+1 {
-				n.MaxSeg = m[1]
-				logDebugf("MaxSeg %s\n", n.MaxSeg)
+			m = findPattern("ROWS_SEG", line)
+			if m != nil {
+				n.MaxSeg = KnownString(m[1])
+				n.logDebugf("MaxSeg %s\n", n.MaxSeg)
 			}
 
-			re = regexp.MustCompile(`Max (\S+) rows \(`)
-			m = re.FindStringSubmatch(line)
-			if len(m) == re.NumSubexp()+1 {
+			m = findPattern("ROWS_MAX_SEG", line)
+			if m != nil {
 				if s, err := strconv.ParseFloat(m[1], 64); err == nil {
-					n.MaxRows = s
+					n.MaxRows = KnownFloat(s)
 				}
-				logDebugf("MaxRows %f\n", n.MaxRows)
+				n.logDebugf("MaxRows %f\n", n.MaxRows)
 
 			} else {
 				// Only execute this if "Max" was not found
-				re = regexp.MustCompile(` (\S+) rows \(`)
-				m = re.FindStringSubmatch(line)
-				if len(m) == re.NumSubexp()+1 {
+				m = findPattern("ROWS_SEG_ROWS", line)
+				if m != nil {
 					if s, err := strconv.ParseFloat(m[1], 64); err == nil {
-						n.ActualRows = s
+						n.ActualRows = KnownFloat(s)
 					}
-					logDebugf("ActualRows %f\n", n.ActualRows)
+					n.logDebugf("ActualRows %f\n", n.ActualRows)
 				}
 			}
 		}
 
 		// MEMORY
-		re = regexp.MustCompile(`Work_mem used`)
-		if re.MatchString(line) {
-			re = regexp.MustCompile(`Work_mem used:\s+(\d+)K bytes avg`)
-			m = re.FindStringSubmatch(line)
-			if len(m) == re.NumSubexp()+1 {
+		if matchPattern("WORKMEM", line) {
+			m = findPattern("WORKMEM_AVG", line)
+			if m != nil {
 				if s, err := strconv.ParseFloat(m[1], 64); err == nil {
-					n.AvgMem = s
-					logDebugf("AvgMem %f\n", n.AvgMem)
+					n.AvgMem = KnownFloat(s)
+					n.logDebugf("AvgMem %f\n", n.AvgMem)
 				}
 			}
 
-			re = regexp.MustCompile(`\s+(\d+)K bytes max`)
-			m = re.FindStringSubmatch(line)
-			if len(m) == re.NumSubexp()+1 {
+			m = findPattern("WORKMEM_MAX", line)
+			if m != nil {
 				if s, err := strconv.ParseFloat(m[1], 64); err == nil {
-					n.MaxMem = s
-					logDebugf("MaxMem %f\n", n.MaxMem)
+					n.MaxMem = KnownFloat(s)
+					n.logDebugf("MaxMem %f\n", n.MaxMem)
 				}
 			}
 		}
 
 		// SPILL
-		re = regexp.MustCompile(`\((\d+) spilling,\s+(\d+) reused\)`)
-		m = re.FindStringSubmatch(line)
-		if len(m) == re.NumSubexp()+1 {
-			n.SpillFile, _ = strconv.ParseInt(strings.TrimSpace(m[1]), 10, 64)
-			n.SpillReuse, _ = strconv.ParseInt(strings.TrimSpace(m[2]), 10, 64)
-			logDebugf("SpillFile %d\n", n.SpillFile)
-			logDebugf("SpillReuse %d\n", n.SpillReuse)
+		m = findPattern("SPILL", line)
+		if m != nil {
+			n.SpillFile = parseOptionalInt(m[1])
+			n.SpillReuse = parseOptionalInt(m[2])
+			n.logDebugf("SpillFile %d\n", n.SpillFile)
+			n.logDebugf("SpillReuse %d\n", n.SpillReuse)
 		}
 
 		// PARTITION SELECTED
-		re = regexp.MustCompile(`Partitions selected:  (\d+) \(out of (\d+)\)`)
-		m = re.FindStringSubmatch(line)
-		if len(m) == re.NumSubexp()+1 {
-			n.PartSelected, _ = strconv.ParseInt(strings.TrimSpace(m[1]), 10, 64)
-			n.PartSelectedTotal, _ = strconv.ParseInt(strings.TrimSpace(m[2]), 10, 64)
-			logDebugf("PartSelectedTotal %d\n", n.PartSelectedTotal)
-			logDebugf("PartSelected %d\n", n.PartSelected)
+		m = findPattern("PART_SELECTED", line)
+		if m != nil {
+			n.PartSelected = parseOptionalInt(m[1])
+			n.PartSelectedTotal = parseOptionalInt(m[2])
+			n.logDebugf("PartSelectedTotal %d\n", n.PartSelectedTotal)
+			n.logDebugf("PartSelected %d\n", n.PartSelected)
 		}
 
 		// PARTITION SCANNED
-		re = regexp.MustCompile(`Partitions scanned:  (Avg ){0,}(.*) \(out of (\d+)\)`)
-		m = re.FindStringSubmatch(line)
-		if len(m) > 0 {
+		m = findPattern("PART_SCANNED", line)
+		if m != nil {
 			partScannedFloat, _ := strconv.ParseFloat(strings.TrimSpace(m[len(m)-2]), 64)
-			n.PartScanned = int64(partScannedFloat)
-			n.PartScannedTotal, _ = strconv.ParseInt(strings.TrimSpace(m[len(m)-1]), 10, 64)
-			logDebugf("PartScannedTotal %d\n", n.PartScannedTotal)
-			logDebugf("PartScanned %d\n", n.PartScanned)
+			n.PartScanned = KnownInt(int64(partScannedFloat))
+			n.PartScannedTotal = parseOptionalInt(m[len(m)-1])
+			n.logDebugf("PartScannedTotal %d\n", n.PartScannedTotal)
+			n.logDebugf("PartScanned %d\n", n.PartScanned)
 		}
 
 		// FILTER
-		re = regexp.MustCompile(`Filter: (.*)`)
-		m = re.FindStringSubmatch(line)
-		if len(m) == re.NumSubexp()+1 {
-			n.Filter = m[1]
-			logDebugf("Filter %s\n", n.Filter)
+		// Skip PostgreSQL "Rows Removed by Filter: 49700"
+		m = findPattern("FILTER", line)
+		if m != nil {
+			n.Filter = m[2]
+			n.logDebugf("Filter %s\n", n.Filter)
+		}
+
+		// CONDITIONS AND KEYS
+		//     Hash Cond: (s.region_id = r.id)
+		//     Hash Key: hd.recorded_time, hd.tori_no::text
+		m = findPattern("CONDITION", line)
+		if m != nil {
+			switch m[1] {
+			case "Hash Cond":
+				n.HashCond = m[2]
+			case "Merge Cond":
+				n.MergeCond = m[2]
+			case "Join Filter":
+				n.JoinFilter = m[2]
+			case "Index Cond":
+				n.IndexCond = m[2]
+			case "Recheck Cond":
+				n.RecheckCond = m[2]
+			case "One-Time Filter":
+				n.OneTimeFilter = m[2]
+			case "Hash Key":
+				n.HashKey = splitExprList(m[2])
+			case "Sort Key":
+				n.SortKey = splitExprList(m[2])
+			case "Group By", "Group Key":
+				// PostgreSQL prints "Group Key"
+				n.GroupBy = splitExprList(m[2])
+			}
+			n.logDebugf("%s %s\n", m[1], m[2])
+		}
+
+		// HASH TABLE
+		// (seg3)   Hash chain length 4.2 avg, 91 max, using 1200 of 524288 buckets.
+		m = findPattern("HASH_CHAIN", line)
+		if m != nil {
+			n.HashChainAvg = parseOptionalFloat(m[1])
+			n.HashChainMax = parseOptionalInt(m[2])
+			n.HashBucketsUsed = parseOptionalInt(m[3])
+			n.HashBuckets = parseOptionalInt(m[4])
+
+			m = findPattern("HASH_CHAIN_SEG", line)
+			if m != nil {
+				n.HashSeg = KnownString(m[1])
+			}
+			n.logDebugf("HashChain %f %d %d %d %s\n", n.HashChainAvg, n.HashChainMax, n.HashBucketsUsed, n.HashBuckets, n.HashSeg)
+		}
+
+		// EXECUTOR MEMORY
+		// Executor memory:  4978K bytes avg, 39416K bytes max (seg2).
+		if matchPattern("EXECMEM", line) {
+			n.ExecMemAvg, n.ExecMemMax, n.ExecMemSeg = parseMemoryLine(line, "EXECMEM")
+			n.logDebugf("ExecMem %f %f %s\n", n.ExecMemAvg, n.ExecMemMax, n.ExecMemSeg)
+		}
+
+		// MEMORY (explain_memory_verbosity)
+		// Memory:  10K bytes avg, 10K bytes max (seg0).
+		// Memory:  28K bytes.
+		if matchPattern("NODE_MEMORY", line) {
+			n.MemoryAvg, n.MemoryMax, n.MemorySeg = parseMemoryLine(line, "NODE_MEMORY")
+			n.logDebugf("Memory %f %f %s\n", n.MemoryAvg, n.MemoryMax, n.MemorySeg)
 		}
 
-		// #Executor memory:  4978K bytes avg, 39416K bytes max (seg2).
-		// if ( $info_line =~ m/Executor memory:/ ) {
-		//     $exec_mem_line .= $info_line."\n";
-		// }
+		// WORK_MEM WANTED
+		// Work_mem wanted: 171875K bytes avg, 171875K bytes max (seg0) to lessen workfile I/O affecting 2 workers.
+		if matchPattern("WORKMEM_WANTED", line) {
+			n.WorkMemWantedAvg, n.WorkMemWantedMax, n.WorkMemWantedSeg = parseMemoryLine(line, "WORKMEM_WANTED")
 
+			m = findPattern("WORKMEM_WANTED_WORKERS", line)
+			if m != nil {
+				n.WorkMemWantedWorkers = parseOptionalInt(m[1])
+			}
+			n.logDebugf("WorkMemWanted %f %f %s %d\n", n.WorkMemWantedAvg, n.WorkMemWantedMax, n.WorkMemWantedSeg, n.WorkMemWantedWorkers)
+		}
 	}
 
 	// From Greenplum code
 	//     Show elapsed time just once if they are the same or if we don't have
 	//     any valid elapsed time for first tuple.
 	// So set it here to avoid having to handle it later
-	if n.MsFirst == -1 {
+	if !n.MsFirst.Valid {
 		n.MsFirst = n.MsEnd
 	}
-
-	return nil
 }
 
-// Check for quotes
-func checkQuote(line string) string {
-	if len(line) > 2 {
-		if `"` == line[0:1] && `"` == line[len(line)-2:len(line)-1] {
-			// If so then remove the doublequotes and add an extra space
-			// The space is so the output matches standard psql output
-			line = " " + line[1:len(line)-2]
-		}
+// Parse "<label>: <avg>K bytes avg, <max>K bytes max (seg<n>)."
+// re must match the label and capture the avg value.
+// If there is only a single value then avg and max are the same
+//     Executor memory:  4978K bytes avg, 39416K bytes max (seg2).
+//     Memory:  28K bytes.
+func parseMemoryLine(line string, name string) (OptionalFloat, OptionalFloat, OptionalString) {
+	m := findPattern(name, line)
+	avg := parseOptionalFloat(m[1])
+	max := avg
+	seg := OptionalString{}
+
+	rest := line[strings.Index(line, m[0])+len(m[0]):]
+	if mm := findPattern("MEMORY_MAX", rest); mm != nil {
+		max = parseOptionalFloat(mm[1])
+		seg = KnownString(mm[2])
 	}
-	return line
+
+	return avg, max, seg
 }
 
 // Render plan for output to console
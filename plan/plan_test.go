@@ -1,6 +1,10 @@
 package plan
 
 import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -15,3 +19,150 @@ func TestNode_parseExtraInfo(t *testing.T) {
 		t.Fatal("It's not a node line")
 	}
 }
+
+func TestNode_parseActual(t *testing.T) {
+	input := "  ->  Index Scan using customers_pkey on customers c  (cost=0.29..8.30 rows=1 width=32) (actual time=0.010..0.012 rows=1 loops=300)"
+
+	explain := Explain{}
+	node := explain.createNode(input)
+	err := parseNodeExtraInfo(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !node.IsAnalyzed || node.MsFirst != KnownFloat(0.010) || node.MsEnd != KnownFloat(0.012) || node.ActualRows != KnownFloat(1) || node.Loops != KnownInt(300) {
+		t.Fatalf("Actual stats not parsed: %+v", node)
+	}
+
+	if node.Width != 32 || node.Object != "customers_pkey" {
+		t.Fatalf("Node line not parsed: width %d object %s", node.Width, node.Object)
+	}
+}
+
+func TestNode_loopAwareTime(t *testing.T) {
+	explain := Explain{}
+	err := explain.InitFromFile("../testdata/explain23.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 12.5 ms total minus 8.1 ms seq scan minus 300 loops of 0.012 ms
+	top := explain.Nodes[0]
+	if top.MsNode.Value < 0.79 || top.MsNode.Value > 0.81 {
+		t.Fatalf("Expected 0.8 ms in nested loop, got %f", top.MsNode)
+	}
+
+	if explain.Nodes[3].IsAnalyzed != true || explain.Nodes[3].Loops != KnownInt(0) {
+		t.Fatal("Expected never executed node to be analyzed with 0 loops")
+	}
+}
+
+func TestNode_parseMemory(t *testing.T) {
+	explain := Explain{}
+	node := explain.createNode("   ->  Hash Join  (cost=0.00..862.00 rows=1 width=16)")
+	node.ExtraInfo = append(node.ExtraInfo,
+		"         Executor memory:  127501K bytes avg, 127502K bytes max (seg1).",
+		"         Work_mem used:  127501K bytes avg, 127501K bytes max (seg0). Workfile: (2 spilling, 0 reused)",
+		"         Work_mem wanted: 171875K bytes avg, 171876K bytes max (seg0) to lessen workfile I/O affecting 2 workers.",
+		"         Memory:  28K bytes.")
+	err := parseNodeExtraInfo(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if node.ExecMemAvg != KnownFloat(127501) || node.ExecMemMax != KnownFloat(127502) || node.ExecMemSeg != KnownString("seg1") {
+		t.Errorf("Executor memory not parsed: %f %f %s", node.ExecMemAvg, node.ExecMemMax, node.ExecMemSeg)
+	}
+
+	if node.WorkMemWantedAvg != KnownFloat(171875) || node.WorkMemWantedMax != KnownFloat(171876) || node.WorkMemWantedSeg != KnownString("seg0") || node.WorkMemWantedWorkers != KnownInt(2) {
+		t.Errorf("Work_mem wanted not parsed: %f %f %s %d", node.WorkMemWantedAvg, node.WorkMemWantedMax, node.WorkMemWantedSeg, node.WorkMemWantedWorkers)
+	}
+
+	if node.MemoryAvg != KnownFloat(28) || node.MemoryMax != KnownFloat(28) || node.MemorySeg != (OptionalString{}) {
+		t.Errorf("Memory not parsed: %f %f %s", node.MemoryAvg, node.MemoryMax, node.MemorySeg)
+	}
+}
+
+func TestNode_parseKeys(t *testing.T) {
+	explain := Explain{}
+	node := explain.createNode("   ->  Hash Join  (cost=0.00..862.00 rows=1 width=16)")
+	node.ExtraInfo = append(node.ExtraInfo,
+		"         Hash Cond: (s.region_id = r.id)",
+		"         Join Filter: (s.amount > r.limit)",
+		"         Hash Key: hd.recorded_time, hd.tori_no::text, coalesce(hd.str_cd, 0)",
+		"         Sort Key: hd.recorded_date DESC, hd.str_cd",
+		"         Group Key: hd.recorded_date",
+		"         One-Time Filter: $0")
+	err := parseNodeExtraInfo(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if node.HashCond != "(s.region_id = r.id)" || node.JoinFilter != "(s.amount > r.limit)" || node.OneTimeFilter != "$0" {
+		t.Errorf("Conditions not parsed: %q %q %q", node.HashCond, node.JoinFilter, node.OneTimeFilter)
+	}
+
+	if !reflect.DeepEqual(node.HashKey, []string{"hd.recorded_time", "hd.tori_no::text", "coalesce(hd.str_cd, 0)"}) {
+		t.Errorf("Hash Key not parsed: %v", node.HashKey)
+	}
+
+	if !reflect.DeepEqual(node.SortKey, []string{"hd.recorded_date DESC", "hd.str_cd"}) {
+		t.Errorf("Sort Key not parsed: %v", node.SortKey)
+	}
+
+	if !reflect.DeepEqual(node.GroupBy, []string{"hd.recorded_date"}) {
+		t.Errorf("Group By not parsed: %v", node.GroupBy)
+	}
+}
+
+// The fast paths must give the same result as running the regexp
+func TestNode_fastPatterns(t *testing.T) {
+	lines := []string{
+		"  ->  Seq Scan on a  (cost=0.00..1.04 rows=4 width=4)",
+		"  ->  Seq Scan on a  (rows=4 width=4)",
+		"  ->  Seq Scan on a  (cost=0.00..1.04 rows=4 width=4)   ",
+		"  ->  Seq Scan on a  (cost=0...5 rows=4 width=4)",
+		"  ->  Seq Scan on a  (cost=0.00..1.04 rows=4 width=4) (extra)",
+		"  ->  Function Scan on f  (cost=0.00..1.04 rows=4 width=4) (x)",
+		"  ->  Result  (cost=1..2..3 rows=4 width=4)",
+		"  ->  Result  (cost=1..2 rows=4 width=4 width=5)",
+		"  Rows out:  0 rows (seg0) with  ms to end, 1 ms to end.",
+		"  Rows out:  Avg 1.0 rows x 2 workers.  Max 1 rows (seg0) with 6.673 ms to first row, 7 ms to end.",
+		"  Rows out:  a12 rows with x ms 3 rows at destination, 4 rows at destination",
+		"  Rows out:  12 rows with  ms, 5 rows with 1 ms to end, x 2x workers x 3 workers",
+		"  Rows out:  Avg  1 Max x rows Max 2 rows (seg) (segx) (seg4) of 5x scans of 6 scans",
+		"   Filter: Filter: (x = 1)",
+		"   Rows Removed by Filter: 5",
+		"\tJoin Filter: (a = b)",
+		"Filter:x",
+		"   Hash Cond:(a = b)",
+		"   Group Key: a, b",
+	}
+
+	files, err := filepath.Glob("../testdata/explain*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.Split(string(data), "\n")...)
+	}
+
+	for _, line := range lines {
+		expected := patterns["NODE"].FindStringSubmatch(line)
+		groups := findNodePattern(line)
+		if (expected == nil) != (groups == nil) || (expected != nil && !reflect.DeepEqual(expected[1:], groups[1:])) {
+			t.Fatalf("NODE mismatch on %q\nexpected %q\ngot      %q", line, expected, groups)
+		}
+
+		for name := range patternLiterals {
+			expected := patterns[name].FindStringSubmatch(line)
+			if !reflect.DeepEqual(expected, findPattern(name, line)) {
+				t.Fatalf("%s mismatch on %q", name, line)
+			}
+		}
+	}
+}
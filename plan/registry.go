@@ -0,0 +1,334 @@
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+const (
+	ScopeOrca   = "orca"
+	ScopeLegacy = "legacy"
+)
+
+const (
+	CheckRan     = "ran"
+	CheckSkipped = "skipped"
+)
+
+// Each check has a section in docs/checks.md named after its ID
+const CheckDocURL = "https://github.com/stephendotcarter/planchecker/blob/master/docs/checks.md"
+
+// The checks which can be run against a plan. DefaultRegistry has the
+// built in checks and is used unless Options.Registry is set
+//     registry := plan.NewRegistry()
+//     err := registry.AddNodeCheck(plan.NodeCheck{ID: "my-check", ...})
+//     explain, err := plan.Parse(ctx, r, plan.Options{Registry: registry})
+type Registry struct {
+	mu            sync.RWMutex
+	nodeChecks    []NodeCheck
+	explainChecks []ExplainCheck
+	ids           map[string]bool
+}
+
+// Describes a check without the function, used to list them
+type CheckInfo struct {
+	ID          string
+	Name        string
+	Description string
+	Severity    string
+	Category    string
+	CreatedAt   string
+	Scope       []string
+	Kind        string // node, explain
+}
+
+func (c CheckInfo) DocURL() string {
+	return CheckDocURL + "#" + c.ID
+}
+
+// Whether a check ran against a plan and if not why
+type CheckRun struct {
+	ID     string
+	Name   string
+	Status string // ran, skipped
+	Reason string // Why it was skipped
+}
+
+func (c CheckRun) String() string {
+	if c.Status == CheckSkipped {
+		return fmt.Sprintf("%s %s: %s", c.ID, c.Status, c.Reason)
+	}
+	return fmt.Sprintf("%s %s", c.ID, c.Status)
+}
+
+var DefaultRegistry = NewRegistry()
+
+// A registry with the built in checks
+func NewRegistry() *Registry {
+	r := &Registry{ids: map[string]bool{}}
+	for _, c := range nodeChecks {
+		if err := r.AddNodeCheck(c); err != nil {
+			panic(err)
+		}
+	}
+	for _, c := range explainChecks {
+		if err := r.AddExplainCheck(c); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+func (r *Registry) AddNodeCheck(c NodeCheck) error {
+	if c.Exec == nil {
+		return errors.New(fmt.Sprintf("Check %s has no function", c.ID))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.validate(c.ID, c.Severity, c.Scope); err != nil {
+		return err
+	}
+	r.ids[c.ID] = true
+	r.nodeChecks = append(r.nodeChecks, c)
+	return nil
+}
+
+func (r *Registry) AddExplainCheck(c ExplainCheck) error {
+	if c.Exec == nil {
+		return errors.New(fmt.Sprintf("Check %s has no function", c.ID))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.validate(c.ID, c.Severity, c.Scope); err != nil {
+		return err
+	}
+	r.ids[c.ID] = true
+	r.explainChecks = append(r.explainChecks, c)
+	return nil
+}
+
+// Called with the lock held
+func (r *Registry) validate(id string, severity string, scope []string) error {
+	if id == "" {
+		return errors.New("Check has no ID")
+	}
+	if r.ids[id] {
+		return errors.New(fmt.Sprintf("Check %s is already registered", id))
+	}
+	switch severity {
+	case SeverityInfo, SeverityWarning, SeverityCritical:
+	default:
+		return errors.New(fmt.Sprintf("Check %s has unknown severity %s", id, severity))
+	}
+	for _, s := range scope {
+		if s != ScopeOrca && s != ScopeLegacy {
+			return errors.New(fmt.Sprintf("Check %s has unknown scope %s", id, s))
+		}
+	}
+	return nil
+}
+
+// All checks, node checks first, in the order they were added
+func (r *Registry) Checks() []CheckInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	checks := []CheckInfo{}
+	for _, c := range r.nodeChecks {
+		checks = append(checks, CheckInfo{c.ID, c.Name, c.Description, c.Severity, c.Category, c.CreatedAt, c.Scope, "node"})
+	}
+	for _, c := range r.explainChecks {
+		checks = append(checks, CheckInfo{c.ID, c.Name, c.Description, c.Severity, c.Category, c.CreatedAt, c.Scope, "explain"})
+	}
+	return checks
+}
+
+// Enable and disable lists can have check IDs or categories. Return an
+// error for anything which is neither
+func (r *Registry) validateNames(names []string) error {
+	known := map[string]bool{}
+	for _, c := range r.Checks() {
+		known[c.ID] = true
+		known[c.Category] = true
+	}
+	for _, name := range names {
+		if !known[name] {
+			return errors.New(fmt.Sprintf("Unknown check or category %s", name))
+		}
+	}
+	return nil
+}
+
+func (r *Registry) snapshot() ([]NodeCheck, []ExplainCheck) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]NodeCheck{}, r.nodeChecks...), append([]ExplainCheck{}, r.explainChecks...)
+}
+
+// Optimizer which produced the plan, orca or legacy. Empty if the plan
+// does not say, in which case checks for either optimizer are run
+func (e *Explain) OptimizerScope() string {
+	switch {
+	case e.Optimizer == "on":
+		return ScopeOrca
+	case e.Optimizer == "off":
+		return ScopeLegacy
+	case e.Dialect == "postgres", patterns["OPTIMIZER_LEGACY"].MatchString(e.OptimizerStatus):
+		return ScopeLegacy
+	}
+	return ""
+}
+
+// Why a check should not run against this plan, empty if it should
+func (e *Explain) skipReason(id string, category string, scope []string) string {
+	listed := func(names []string) bool {
+		for _, name := range names {
+			if name == id || name == category {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(e.enableChecks) > 0 && !listed(e.enableChecks) {
+		return "not enabled"
+	}
+	if listed(e.disableChecks) {
+		return "disabled"
+	}
+
+	optimizer := e.OptimizerScope()
+	if optimizer == "" || len(scope) == 0 {
+		return ""
+	}
+	for _, s := range scope {
+		if s == optimizer {
+			return ""
+		}
+	}
+	return fmt.Sprintf("only applies to %s plans", strings.Join(scope, "/"))
+}
+
+// Run the enabled checks which apply to the optimizer, recording which
+// ran and which were skipped in CheckRuns
+func (e *Explain) runChecks() {
+	registry := e.registry
+	if registry == nil {
+		registry = DefaultRegistry
+	}
+	allNodeChecks, allExplainChecks := registry.snapshot()
+
+	e.Thresholds = DefaultThresholds()
+	if e.thresholds != nil {
+		e.Thresholds = *e.thresholds
+	}
+	for _, n := range e.Nodes {
+		n.explain = e
+	}
+
+	e.CheckRuns = []CheckRun{}
+	run := func(id string, name string, category string, scope []string) bool {
+		if reason := e.skipReason(id, category, scope); reason != "" {
+			e.logDebugf("Skipping check %s: %s\n", id, reason)
+			e.CheckRuns = append(e.CheckRuns, CheckRun{id, name, CheckSkipped, reason})
+			return false
+		}
+		e.CheckRuns = append(e.CheckRuns, CheckRun{id, name, CheckRan, ""})
+		return true
+	}
+
+	enabledNodeChecks := []NodeCheck{}
+	for _, c := range allNodeChecks {
+		if run(c.ID, c.Name, c.Category, c.Scope) {
+			enabledNodeChecks = append(enabledNodeChecks, c)
+		}
+	}
+	enabledExplainChecks := []ExplainCheck{}
+	for _, c := range allExplainChecks {
+		if run(c.ID, c.Name, c.Category, c.Scope) {
+			enabledExplainChecks = append(enabledExplainChecks, c)
+		}
+	}
+
+	for _, n := range e.Nodes {
+		for _, c := range enabledNodeChecks {
+			before := len(n.Warnings)
+			c.Exec(n)
+			linkWarnings(n.Warnings[before:], c.ID, c.Severity, n)
+		}
+	}
+
+	// Explain checks can warn about the whole plan or individual nodes
+	for _, c := range enabledExplainChecks {
+		before := len(e.Warnings)
+		nodesBefore := make([]int, len(e.Nodes))
+		for i, n := range e.Nodes {
+			nodesBefore[i] = len(n.Warnings)
+		}
+
+		c.Exec(e)
+
+		linkWarnings(e.Warnings[before:], c.ID, c.Severity, nil)
+		for i, n := range e.Nodes {
+			linkWarnings(n.Warnings[nodesBefore[i]:], c.ID, c.Severity, n)
+		}
+	}
+}
+
+// Fill in where new warnings came from. Checks may set a different
+// severity or doc link for a warning so keep them if set
+func linkWarnings(warnings []Warning, id string, severity string, n *Node) {
+	for i := range warnings {
+		w := &warnings[i]
+		w.CheckID = id
+		if w.DocURL == "" {
+			w.DocURL = CheckDocURL + "#" + id
+		}
+		if w.Severity == "" {
+			w.Severity = severity
+		}
+		if n != nil {
+			w.Node = n
+			w.NodeID = KnownInt(int64(n.ID))
+			if w.LineStart == 0 {
+				w.LineStart = n.LineStart
+				w.LineEnd = n.LineEnd
+			}
+		}
+	}
+}
+
+// Warnings about the whole plan followed by the warnings for each node
+// in the order they are in the plan
+func (e *Explain) AllWarnings() []Warning {
+	warnings := append([]Warning{}, e.Warnings...)
+	for _, n := range e.Nodes {
+		warnings = append(warnings, n.Warnings...)
+	}
+	return warnings
+}
+
+// Number of checks which ran and were skipped
+func (e *Explain) CheckCounts() (int, int) {
+	ran, skipped := 0, 0
+	for _, c := range e.CheckRuns {
+		if c.Status == CheckRan {
+			ran++
+		} else {
+			skipped++
+		}
+	}
+	return ran, skipped
+}
@@ -0,0 +1,123 @@
+package plan
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func parseFileWithOptions(t *testing.T, file string, opts Options) *Explain {
+	f, err := os.Open("../testdata/" + file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	explain, err := Parse(context.Background(), f, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return explain
+}
+
+func parseStringWithOptions(t *testing.T, text string, opts Options) *Explain {
+	explain, err := Parse(context.Background(), strings.NewReader(text), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return explain
+}
+
+func checkRun(e *Explain, id string) CheckRun {
+	for _, c := range e.CheckRuns {
+		if c.ID == id {
+			return c
+		}
+	}
+	return CheckRun{}
+}
+
+func TestRegistry_scope(t *testing.T) {
+	// Optimizer status: legacy query optimizer
+	explain := parseFileWithOptions(t, "explain03.txt", Options{})
+	if explain.OptimizerScope() != ScopeLegacy {
+		t.Fatalf("Expected legacy plan, got %q", explain.OptimizerScope())
+	}
+
+	c := checkRun(explain, "planner-fallback")
+	if c.Status != CheckSkipped || c.Reason != "only applies to orca plans" {
+		t.Errorf("Expected planner-fallback to be skipped, got %s", c)
+	}
+	if c := checkRun(explain, "cartesian-product"); c.Status != CheckRan {
+		t.Errorf("Expected cartesian-product to run, got %s", c)
+	}
+
+	ran, skipped := explain.CheckCounts()
+	if ran+skipped != len(DefaultRegistry.Checks()) || skipped != 2 {
+		t.Errorf("Expected 2 of %d checks skipped, got %d", len(DefaultRegistry.Checks()), skipped)
+	}
+}
+
+func TestRegistry_enableDisable(t *testing.T) {
+	explain := parseFileWithOptions(t, "explain05.txt", Options{EnableChecks: []string{"memory"}, DisableChecks: []string{"spilling"}})
+
+	for _, c := range explain.CheckRuns {
+		info := CheckInfo{}
+		for _, i := range DefaultRegistry.Checks() {
+			if i.ID == c.ID {
+				info = i
+			}
+		}
+		switch {
+		case c.ID == "spilling":
+			if c.Status != CheckSkipped || c.Reason != "disabled" {
+				t.Errorf("Expected spilling to be disabled, got %s", c)
+			}
+		case info.Category == "memory":
+			if c.Status != CheckRan {
+				t.Errorf("Expected %s to run, got %s", c.ID, c)
+			}
+		default:
+			if c.Status != CheckSkipped || c.Reason != "not enabled" {
+				t.Errorf("Expected %s to be skipped, got %s", c.ID, c)
+			}
+		}
+	}
+
+	_, err := Parse(context.Background(), nil, Options{DisableChecks: []string{"no-such-check"}})
+	if err == nil || err.Error() != "Unknown check or category no-such-check" {
+		t.Errorf("Expected unknown check error, got %v", err)
+	}
+}
+
+func TestRegistry_add(t *testing.T) {
+	registry := NewRegistry()
+	check := NodeCheck{
+		ID:       "every-node",
+		Severity: SeverityInfo,
+		Category: "test",
+		Exec: func(n *Node) {
+			n.Warnings = append(n.Warnings, Warning{Cause: "Visited", Resolution: "None"})
+		},
+	}
+	if err := registry.AddNodeCheck(check); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.AddNodeCheck(check); err == nil {
+		t.Error("Expected an error adding the same ID twice")
+	}
+	if err := registry.AddExplainCheck(ExplainCheck{ID: "bad", Severity: "fatal", Exec: func(*Explain) {}}); err == nil {
+		t.Error("Expected an error for an unknown severity")
+	}
+	if len(DefaultRegistry.Checks()) == len(registry.Checks()) {
+		t.Error("Expected the check to only be added to the new registry")
+	}
+
+	explain := parseFileWithOptions(t, "explain01.txt", Options{Registry: registry, EnableChecks: []string{"every-node"}})
+	for _, n := range explain.Nodes {
+		if len(n.Warnings) != 1 || n.Warnings[0].Cause != "Visited" {
+			t.Errorf("Expected only the new check to run on %s, got %v", n.Operator, n.Warnings)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Machine readable summary of a parsed plan, see Explain.Report
+type Report struct {
+	Format      string
+	Dialect     string
+	Optimizer   string // orca, legacy or empty if the plan does not say
+	Thresholds  Thresholds
+	Warnings    []Warning
+	CheckRuns   []CheckRun
+	Diagnostics []Diagnostic
+}
+
+// Everything a tool needs to act on the warnings without the plan text
+//     data, err := json.Marshal(explain.Report())
+func (e *Explain) Report() Report {
+	return Report{
+		Format:      e.Format,
+		Dialect:     e.Dialect,
+		Optimizer:   e.OptimizerScope(),
+		Thresholds:  e.Thresholds,
+		Warnings:    e.AllWarnings(),
+		CheckRuns:   e.CheckRuns,
+		Diagnostics: e.Diagnostics,
+	}
+}
+
+// Reports for several plans as a JSON array
+func ReportsJSON(explains []*Explain) ([]byte, error) {
+	reports := []Report{}
+	for _, e := range explains {
+		reports = append(reports, e.Report())
+	}
+	return json.MarshalIndent(reports, "", "  ")
+}
+
+// Sorted by name e.g. "measured=12 threshold=5"
+func (p WarningParams) String() string {
+	names := []string{}
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := []string{}
+	for _, name := range names {
+		values = append(values, fmt.Sprintf("%s=%v", name, p[name]))
+	}
+	return strings.Join(values, " ")
+}
@@ -0,0 +1,103 @@
+package plan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestWarning_linked(t *testing.T) {
+	explain := Explain{}
+	err := explain.InitFromFile("../testdata/explain01.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ->  Dynamic Table Scan on sales (dynamic scan id: 1)  (cost=0.00..431.00 rows=1 width=8)
+	//       Filter: year = 2015
+	scan := explain.FindByObject("sales")[0]
+	if len(scan.Warnings) != 1 {
+		t.Fatalf("Expected 1 warning, got %v", scan.Warnings)
+	}
+
+	w := scan.Warnings[0]
+	if w.CheckID != "estimated-rows" || w.Severity != SeverityWarning || w.Node != scan || w.NodeID != KnownInt(int64(scan.ID)) {
+		t.Errorf("Unexpected check or node %+v", w)
+	}
+	if w.LineStart != 8 || w.LineEnd != 9 || w.Params["estimated"] != int64(1) {
+		t.Errorf("Unexpected lines or params %+v", w)
+	}
+	if w.DocURL != CheckDocURL+"#estimated-rows" {
+		t.Errorf("Unexpected doc link %s", w.DocURL)
+	}
+	if w.String() != `WARNING: Estimated rows is 1 | May need to run ANALYZE on table "sales" (estimated-rows, lines 8-9)` {
+		t.Errorf("Unexpected string %s", w)
+	}
+}
+
+func TestWarning_params(t *testing.T) {
+	explain := Explain{}
+	err := explain.InitFromFile("../testdata/explain12.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(explain.Warnings) != 1 {
+		t.Fatalf("Expected 1 warning, got %v", explain.Warnings)
+	}
+	w := explain.Warnings[0]
+	if w.CheckID != "motion-count" || w.Node != nil || w.NodeID.Valid || w.LineStart != 0 {
+		t.Errorf("Expected a warning about the whole plan, got %+v", w)
+	}
+	if w.Params.String() != "measured=5 threshold=5" {
+		t.Errorf("Unexpected params %s", w.Params)
+	}
+}
+
+func TestReport_json(t *testing.T) {
+	plantext, err := ioutil.ReadFile("../testdata/explain01.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Line numbers in the second plan are relative to the whole input
+	shift := strings.Count(string(plantext), "\n") + 1
+	explains, err := InitPlans(string(plantext)+"\n"+string(plantext), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(explains) != 2 {
+		t.Fatalf("Expected 2 plans, got %d", len(explains))
+	}
+
+	data, err := ReportsJSON(explains)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reports []struct {
+		Optimizer string
+		Warnings  []struct {
+			CheckID   string
+			Severity  string
+			NodeID    *int
+			LineStart int
+			Params    map[string]interface{}
+		}
+		CheckRuns []CheckRun
+	}
+	if err := json.Unmarshal(data, &reports); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reports) != 2 || reports[0].Optimizer != ScopeOrca || len(reports[1].Warnings) != 1 || len(reports[1].CheckRuns) == 0 {
+		t.Fatalf("Unexpected reports %s", data)
+	}
+	w := reports[1].Warnings[0]
+	if w.CheckID != "estimated-rows" || w.NodeID == nil || w.LineStart != 8+shift || w.Params["estimated"] != 1.0 {
+		t.Errorf("Unexpected warning %+v", w)
+	}
+	if strings.Contains(string(data), `"Node"`) {
+		t.Error("Expected the node to only be referenced by ID")
+	}
+}
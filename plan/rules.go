@@ -0,0 +1,261 @@
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A check written in a config file instead of Go. The warning text can
+// include any field in {}
+//     rules:
+//       - id: fact-seq-scan
+//         description: Seq Scan of a large fact table
+//         when: operator =~ "^Seq Scan" && object =~ "^fact_" && rows > 1e8
+//         cause: Seq Scan on {object} estimates {rows} rows
+//         resolution: Filter on the partition key
+// See condition.go for what can go in "when"
+type Rule struct {
+	ID          string
+	Name        string   // Defaults to the ID
+	Description string   // Defaults to the condition
+	Severity    string   // Defaults to warning
+	Category    string   // Defaults to custom
+	Optimizer   []string // orca, legacy. Empty for both
+	Level       string   // node or explain, defaults to node
+	When        string
+	Cause       string // Defaults to the description
+	Resolution  string // Defaults to "Review query"
+	DocURL      string // Defaults to the rules section of docs/checks.md
+}
+
+const (
+	RuleLevelNode    = "node"
+	RuleLevelExplain = "explain"
+)
+
+var rulePatterns = map[string]*regexp.Regexp{
+	"PLACEHOLDER": regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_.]*)\}`),
+}
+
+// Rule with the defaults filled in and the condition parsed
+type compiledRule struct {
+	Rule
+	when       condition
+	fields     []fieldCondition
+	cause      []fieldCondition
+	resolution []fieldCondition
+}
+
+func (r Rule) compile() (*compiledRule, error) {
+	if r.ID == "" {
+		return nil, errors.New("Rule has no id")
+	}
+	fail := func(err error) (*compiledRule, error) {
+		return nil, errors.New(fmt.Sprintf("Rule %s: %s", r.ID, err))
+	}
+
+	if r.Name == "" {
+		r.Name = r.ID
+	}
+	if r.Description == "" {
+		r.Description = r.When
+	}
+	if r.Severity == "" {
+		r.Severity = SeverityWarning
+	}
+	if r.Category == "" {
+		r.Category = "custom"
+	}
+	if r.Level == "" {
+		r.Level = RuleLevelNode
+	}
+	if r.Cause == "" {
+		r.Cause = r.Description
+	}
+	if r.Resolution == "" {
+		r.Resolution = "Review query"
+	}
+	if r.DocURL == "" {
+		r.DocURL = CheckDocURL + "#rules"
+	}
+
+	if r.Level != RuleLevelNode && r.Level != RuleLevelExplain {
+		return fail(errors.New(fmt.Sprintf("unknown level %s, expected node or explain", r.Level)))
+	}
+	if r.When == "" {
+		return fail(errors.New("no condition"))
+	}
+	// The link is shown in the webservice
+	if u, err := url.Parse(r.DocURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fail(errors.New(fmt.Sprintf("doc_url %s is not an http or https URL", r.DocURL)))
+	}
+
+	c := &compiledRule{Rule: r}
+	var err error
+	c.when, c.fields, err = parseCondition(r.When, r.Level == RuleLevelNode)
+	if err != nil {
+		return fail(err)
+	}
+	if c.cause, err = r.placeholders(r.Cause); err != nil {
+		return fail(err)
+	}
+	if c.resolution, err = r.placeholders(r.Resolution); err != nil {
+		return fail(err)
+	}
+	return c, nil
+}
+
+// Fields used in {} in the warning text
+func (r Rule) placeholders(text string) ([]fieldCondition, error) {
+	fields := []fieldCondition{}
+	for _, m := range rulePatterns["PLACEHOLDER"].FindAllStringSubmatch(text, -1) {
+		f, err := lookupField(m[1], r.Level == RuleLevelNode)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func (c *compiledRule) expand(text string, fields []fieldCondition, env conditionEnv) string {
+	i := 0
+	return rulePatterns["PLACEHOLDER"].ReplaceAllStringFunc(text, func(string) string {
+		f := fields[i]
+		i++
+		return f.eval(env).format(f.kind())
+	})
+}
+
+// The fields used in the condition are added as Params
+func (c *compiledRule) warning(env conditionEnv) Warning {
+	params := WarningParams{}
+	for _, f := range c.fields {
+		params[f.name] = f.eval(env).param(f.kind())
+	}
+	return Warning{
+		Cause:      c.expand(c.Cause, c.cause, env),
+		Resolution: c.expand(c.Resolution, c.resolution, env),
+		Params:     params,
+		DocURL:     c.DocURL,
+	}
+}
+
+// Add a rule as a node or explain check
+func (r *Registry) AddRule(rule Rule) error {
+	c, err := rule.compile()
+	if err != nil {
+		return err
+	}
+
+	if c.Level == RuleLevelExplain {
+		return r.AddExplainCheck(ExplainCheck{c.ID, c.Name, c.Description, c.Severity, c.Category, "", c.Optimizer,
+			func(e *Explain) {
+				env := conditionEnv{explain: e}
+				if c.when.eval(env).Bool {
+					e.Warnings = append(e.Warnings, c.warning(env))
+				}
+			}})
+	}
+
+	return r.AddNodeCheck(NodeCheck{c.ID, c.Name, c.Description, c.Severity, c.Category, "", c.Optimizer,
+		func(n *Node) {
+			env := conditionEnv{explain: n.explain, node: n}
+			if c.when.eval(env).Bool {
+				n.Warnings = append(n.Warnings, c.warning(env))
+			}
+		}})
+}
+
+// Rules from the "rules" list in a config file
+func parseRules(value interface{}) ([]Rule, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, errors.New("rules should be a list")
+	}
+
+	rules := []Rule{}
+	for i, item := range list {
+		values, ok := configMap(item)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("Rule %d should be a mapping", i+1))
+		}
+		rule, err := parseRule(values)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Rule %d: %s", i+1, err))
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func parseRule(values map[string]interface{}) (Rule, error) {
+	rule := Rule{}
+
+	// Sorted so the error is the same every time
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := values[key]
+
+		if key == "optimizer" {
+			switch v := value.(type) {
+			case string:
+				rule.Optimizer = splitList(v)
+			case []interface{}:
+				for _, o := range v {
+					s, ok := o.(string)
+					if !ok {
+						return rule, errors.New("optimizer should be orca or legacy")
+					}
+					rule.Optimizer = append(rule.Optimizer, s)
+				}
+			default:
+				return rule, errors.New("optimizer should be orca or legacy")
+			}
+			continue
+		}
+
+		var field *string
+		switch key {
+		case "id":
+			field = &rule.ID
+		case "name":
+			field = &rule.Name
+		case "description":
+			field = &rule.Description
+		case "severity":
+			field = &rule.Severity
+		case "category":
+			field = &rule.Category
+		case "level":
+			field = &rule.Level
+		case "when":
+			field = &rule.When
+		case "cause":
+			field = &rule.Cause
+		case "resolution":
+			field = &rule.Resolution
+		case "doc_url":
+			field = &rule.DocURL
+		default:
+			return rule, errors.New(fmt.Sprintf("Unknown setting %s", key))
+		}
+
+		s, ok := value.(string)
+		if !ok {
+			return rule, errors.New(fmt.Sprintf("%s should be text", key))
+		}
+		*field = strings.TrimSpace(s)
+	}
+
+	return rule, nil
+}
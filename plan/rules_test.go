@@ -0,0 +1,123 @@
+package plan
+
+import (
+	"testing"
+)
+
+func TestCondition_eval(t *testing.T) {
+	n := &Node{Operator: "Seq Scan", Object: "fact_sales", Rows: 200000000, Width: 8, ActualRows: KnownFloat(10)}
+	e := &Explain{Nodes: []*Node{n}, Settings: []Setting{{"enable_nestloop", "on"}}, Optimizer: "off"}
+	env := conditionEnv{explain: e, node: n}
+
+	tests := map[string]bool{
+		`operator == "Seq Scan" && object =~ "^fact_" && rows > 1e8`:     true,
+		`Operator == 'Seq Scan' && Object !~ "^fact_"`:                   false,
+		`actual_rows * 1000 < rows`:                                      true,
+		`ActualRows > 5 || avg_rows > 5`:                                 true,
+		`!(rows - width * 2 >= -1)`:                                      false,
+		`settings.enable_nestloop == "on" && explain.optimizer == "off"`: true,
+		`settings.enable_hashjoin == "off"`:                              false,
+		`explain.nodes == 1 && is_analyzed == false`:                     true,
+		// Comparisons with values not in the plan are false
+		`avg_rows < 5`:                           false,
+		`!(avg_rows < 5)`:                        true,
+		`max_seg == "seg0" || max_seg != "seg0"`: false,
+	}
+
+	for text, expected := range tests {
+		c, _, err := parseCondition(text, true)
+		if err != nil {
+			t.Errorf("%s: %s", text, err)
+			continue
+		}
+		if got := c.eval(env).Bool; got != expected {
+			t.Errorf("%s: expected %v, got %v", text, expected, got)
+		}
+	}
+}
+
+func TestCondition_errors(t *testing.T) {
+	tests := map[string]string{
+		`rows > "a"`:           "Can not compare number with text at column 8",
+		`rows`:                 "Condition must be true/false, got number",
+		`rowz > 1`:             "Unknown field rowz at column 1",
+		`operator =~ "(" `:     `Invalid regular expression ( at column 13`,
+		`(rows > 1`:            "Expected ) at column 10",
+		`rows > 1 && operator`: "&& needs true/false, got text at column 13",
+		`object == "a`:         "Unterminated string at column 11",
+		`rows # 1`:             `Unexpected '#' at column 6`,
+	}
+
+	for text, expected := range tests {
+		if _, _, err := parseCondition(text, true); err == nil || err.Error() != expected {
+			t.Errorf("%s: expected %q, got %v", text, expected, err)
+		}
+	}
+
+	// Explain rules use the explain fields without a prefix
+	if _, _, err := parseCondition(`runtime > 1000 && nodes > 10`, false); err != nil {
+		t.Error(err)
+	}
+	if _, _, err := parseCondition(`rows > 1`, false); err == nil {
+		t.Error("Expected node fields to be unknown in explain rules")
+	}
+}
+
+func TestRules_config(t *testing.T) {
+	config, err := ParseConfig(`
+rules:
+  - id: big-seq-scan
+    severity: critical
+    when: operator =~ "^Seq Scan" && rows > 2000
+    cause: Seq Scan on {object} estimates {rows} rows
+    resolution: Filter on the partition key
+  - id: legacy-nodes
+    level: explain
+    optimizer: legacy
+    when: nodes > 3
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry, err := config.Registry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(registry.Checks()) != len(DefaultRegistry.Checks())+2 {
+		t.Fatalf("Expected the rules to be added, got %v", registry.Checks())
+	}
+
+	explain := parseFileWithOptions(t, "explain03.txt", Options{Registry: registry, EnableChecks: []string{"custom"}})
+
+	warnings := explain.AllWarnings()
+	if len(warnings) != 2 {
+		t.Fatalf("Expected 2 warnings, got %v", warnings)
+	}
+	w := warnings[1]
+	if w.CheckID != "big-seq-scan" || w.Severity != SeverityCritical || w.Node == nil || w.DocURL != CheckDocURL+"#rules" {
+		t.Errorf("Unexpected warning %+v", w)
+	}
+	if w.Cause != "Seq Scan on sales_1_prt_outlying_years estimates 2477 rows" || w.Params["rows"] != 2477.0 {
+		t.Errorf("Unexpected cause or params %+v", w)
+	}
+	if warnings[0].CheckID != "legacy-nodes" || warnings[0].Cause != "nodes > 3" || warnings[0].Node != nil {
+		t.Errorf("Unexpected explain warning %+v", warnings[0])
+	}
+}
+
+func TestRules_configErrors(t *testing.T) {
+	tests := map[string]string{
+		"rules:\n  - id: a\n    when: rows > 1\n    color: red\n":                   "Rule 1: Unknown setting color",
+		"rules:\n  - id: a\n    level: plan\n    when: rows > 1\n":                  "Rule a: unknown level plan, expected node or explain",
+		"rules:\n  - id: a\n    when: rows > 1\n    cause: {rowz}\n":                "Rule a: Unknown field rowz",
+		"rules:\n  - id: scans\n    when: rows > 1\n":                               "Check scans is already registered",
+		"rules:\n  - when: rows > 1\n":                                              "Rule has no id",
+		"rules:\n  - id: a\n    when: rows > 1\n    doc_url: javascript:alert(1)\n": "Rule a: doc_url javascript:alert(1) is not an http or https URL",
+	}
+
+	for text, expected := range tests {
+		if _, err := ParseConfig(text); err == nil || err.Error() != expected {
+			t.Errorf("Expected %q, got %v", expected, err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package plan
+
+import (
+	"fmt"
+)
+
+// Data moves between slices through motion nodes. Each motion node is
+// an edge in the slice graph from the slice it is labelled with (the
+// sending slice) to the slice of the node above it (the receiving slice)
+//     Gather Motion 2:1  (slice2; segments: 2)          slice2 -> slice0
+//       ->  Hash Join
+//             ->  Redistribute Motion 2:2  (slice1)      slice1 -> slice2
+// Slice 0 is the query dispatcher
+type SliceEdge struct {
+	From   int64 // Sending slice
+	To     int64 // Receiving slice
+	Motion *Node
+}
+
+func (s SliceEdge) String() string {
+	return fmt.Sprintf("slice%d -> slice%d %s", s.From, s.To, s.Motion.Operator)
+}
+
+// Return the edges of the slice graph starting from the top node,
+// ordered as they appear in the plan
+func (e *Explain) SliceGraph() []SliceEdge {
+	edges := []SliceEdge{}
+	if len(e.Plans) == 0 || e.Plans[0].TopNode == nil {
+		return edges
+	}
+	sliceEdges(e.Plans[0].TopNode, 0, &edges)
+	return edges
+}
+
+// Nodes without a slice label run in the same slice as the node above
+func sliceEdges(n *Node, slice int64, edges *[]SliceEdge) {
+	current := slice
+	if n.MotionType != "" && n.Slice.Valid {
+		*edges = append(*edges, SliceEdge{n.Slice.Value, slice, n})
+		current = n.Slice.Value
+	} else if n.Slice.Valid {
+		current = n.Slice.Value
+	}
+
+	for _, s := range n.SubNodes {
+		sliceEdges(s, current, edges)
+	}
+	for _, p := range n.SubPlans {
+		if p.TopNode != nil {
+			sliceEdges(p.TopNode, current, edges)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package plan
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// A psql session log or "psql -f" output can contain several plans:
+//     analytics=> explain select ...;
+//                          QUERY PLAN
+//     -------------------------------------------------
+//      Gather Motion 2:1  (slice1; segments: 2)  (cost=...)
+//        ->  Seq Scan on sales  (cost=...)
+//     (2 rows)
+//
+//     analytics=> explain select ...;
+//     ...
+// A new plan starts at a "QUERY PLAN" header, a psql prompt or a top
+// level node after the footer of the previous plan (Settings, Total
+// runtime etc...). A "(N rows)" footer ends the current plan.
+// Structured formats are returned as is.
+func splitPlans(plantext string) []string {
+	if detectFormat(plantext) != "text" {
+		return []string{plantext}
+	}
+
+	chunks := []string{}
+	current := []string{}
+	hasNode := false
+	hasFooter := false
+
+	// Lines before a plan (prompt, query etc...) are kept with it
+	boundary := func() {
+		if hasNode {
+			chunks = append(chunks, strings.Join(current, "\n"))
+			current = []string{}
+			hasNode = false
+			hasFooter = false
+		}
+	}
+
+	for _, line := range strings.Split(plantext, "\n") {
+		trimmed := strings.TrimRight(line, "\r")
+		if strings.HasPrefix(trimmed, `"`) {
+			// pgAdmin quoted line, see normaliseText()
+			trimmed = " " + trimmed[1:]
+		}
+
+		if hasNode && (strings.Contains(trimmed, "QUERY PLAN") || normalisePatterns["PROMPT"].MatchString(trimmed)) {
+			boundary()
+		}
+
+		if isNodeLine(trimmed) && !matchPattern("SUBPLAN", trimmed) {
+			if hasFooter && getIndent(trimmed) <= 1 {
+				boundary()
+			}
+			hasNode = true
+		} else if hasNode && isPlanFooter(trimmed) {
+			hasFooter = true
+		}
+
+		current = append(current, line)
+
+		if isRowCount(trimmed) {
+			boundary()
+		}
+	}
+
+	// Trailing lines without a plan e.g. "Time: 12.345 ms"
+	if !hasNode && len(chunks) > 0 {
+		chunks[len(chunks)-1] += "\n" + strings.Join(current, "\n")
+	} else {
+		chunks = append(chunks, strings.Join(current, "\n"))
+	}
+
+	return chunks
+}
+
+// Lines which come after the nodes of a plan
+func isPlanFooter(line string) bool {
+	// Every footer has a colon, most plan lines can be skipped without
+	// trying each pattern
+	if strings.IndexByte(line, ':') < 0 {
+		return false
+	}
+	for _, name := range []string{"SLICESTATS", "STATEMENTSTATS", "SETTINGS", "OPTIMIZER", "OPTIMIZER_NAME", "RUNTIME", "PLANNINGTIME", "EXECUTIONTIME", "MEMORY"} {
+		if matchPattern(name, line) {
+			return true
+		}
+	}
+	return false
+}
+
+// Init every plan in the text, see ParseAll
+func InitPlans(plantext string, debug bool, lenient bool) ([]*Explain, error) {
+	return ParseAll(context.Background(), strings.NewReader(plantext), initOptions(debug, lenient))
+}
+
+// Init every plan in a file
+func InitPlansFromFile(filename string, debug bool, lenient bool) ([]*Explain, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseAll(context.Background(), f, initOptions(debug, lenient))
+}
+
+// Init every plan from stdin e.g. psql -f myqueries.sql | planchecker
+func InitPlansFromStdin(debug bool, lenient bool) ([]*Explain, error) {
+	bytes, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bytes) == 0 {
+		return nil, errors.New("stdin is empty")
+	}
+
+	return InitPlans(string(bytes), debug, lenient)
+}
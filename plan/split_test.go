@@ -0,0 +1,60 @@
+package plan
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplit_session(t *testing.T) {
+	explains, err := InitPlansFromFile("../testdata/explain25.txt", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(explains) != 2 {
+		t.Fatalf("Expected 2 plans, got %d", len(explains))
+	}
+
+	if len(explains[0].Nodes) != 4 || explains[0].Nodes[0].Operator != "Aggregate" {
+		t.Errorf("First plan not parsed, %d nodes", len(explains[0].Nodes))
+	}
+
+	if len(explains[1].Nodes) != 6 || explains[1].Nodes[0].Operator != "Gather Motion 2:1" {
+		t.Errorf("Second plan not parsed, %d nodes", len(explains[1].Nodes))
+	}
+
+	for i, e := range explains {
+		if e.OptimizerStatus != "PQO version 2.55.20" {
+			t.Errorf("Plan %d: expected optimizer status, got %q", i+1, e.OptimizerStatus)
+		}
+	}
+}
+
+func TestSplit_rootNodes(t *testing.T) {
+	input := " Seq Scan on a  (cost=0.00..1.00 rows=1 width=4)\n" +
+		"   Filter: x = 1\n" +
+		" Total runtime: 1.234 ms\n" +
+		" Seq Scan on b  (cost=0.00..1.00 rows=1 width=4)\n"
+
+	chunks := splitPlans(input)
+	if len(chunks) != 2 {
+		t.Fatalf("Expected 2 plans, got %d: %q", len(chunks), chunks)
+	}
+
+	// Without the footer it is a badly indented node, not a new plan
+	chunks = splitPlans(strings.Replace(input, " Total runtime: 1.234 ms\n", "", 1))
+	if len(chunks) != 1 {
+		t.Fatalf("Expected 1 plan, got %d: %q", len(chunks), chunks)
+	}
+}
+
+func TestSplit_single(t *testing.T) {
+	explains, err := InitPlansFromFile("../testdata/explain12.txt", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(explains) != 1 {
+		t.Fatalf("Expected 1 plan, got %d", len(explains))
+	}
+}
@@ -0,0 +1,176 @@
+package plan
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A table whose statistics look stale, with the nodes which showed it
+type StaleTable struct {
+	Table       string   // Root table for partitions
+	Partitioned bool     // Partitions, a Dynamic Table Scan or Partition Selector were seen
+	Partitions  []string // Child partitions scanned, in plan order
+	NodeIDs     []int
+	Rows        float64 // Rows read with the wrong estimate, used to rank the tables
+}
+
+// Root table of a partition child, or the name unchanged. The name is
+// cut at the first _<level>_prt_ with text before and after it
+//     sales_1_prt_outlying_years  ->  sales
+//     sales_1_prt_2013_2_prt_east ->  sales
+func RootTable(object string) string {
+	offset := 0
+	for {
+		i := strings.Index(object[offset:], "_prt_")
+		if i == -1 {
+			return object
+		}
+		i += offset
+		offset = i + 1
+
+		// Digits of the partition level, with an underscore before them
+		start := i
+		for start > 0 && object[start-1] >= '0' && object[start-1] <= '9' {
+			start--
+		}
+		if start < i && start > 1 && object[start-1] == '_' && i+len("_prt_") < len(object) {
+			return object[:start-1]
+		}
+	}
+}
+
+// The estimated-rows check: a table scan estimating 1 row, with more
+// rows found if analyzed
+func (n *Node) estimatedOneRow() bool {
+	if !matchPattern("SCAN_OPERATOR", n.Operator) || n.Rows != 1 {
+		return false
+	}
+	return !n.IsAnalyzed || n.ActualRows.Or(0) > 1 || n.AvgRows.Or(0) > 1
+}
+
+// Tables with stale statistics, found from scans estimating 1 row and
+// the lowest misestimated nodes. The tables with the most rows read
+// using the wrong estimate are first
+func (e *Explain) StaleStatistics() []StaleTable {
+	thresholds := e.Thresholds
+	if thresholds == (Thresholds{}) {
+		thresholds = DefaultThresholds()
+	}
+
+	tables := map[string]*StaleTable{}
+	order := []string{}
+	add := func(object string, n *Node, rows float64) {
+		name := RootTable(object)
+		t, ok := tables[name]
+		if !ok {
+			t = &StaleTable{Table: name, Partitions: []string{}, NodeIDs: []int{}}
+			tables[name] = t
+			order = append(order, name)
+		}
+		if name != object {
+			t.Partitioned = true
+			if !containsString(t.Partitions, object) {
+				t.Partitions = append(t.Partitions, object)
+			}
+		}
+		if len(t.NodeIDs) == 0 || t.NodeIDs[len(t.NodeIDs)-1] != n.ID {
+			t.NodeIDs = append(t.NodeIDs, n.ID)
+		}
+		t.Rows += rows
+	}
+
+	for _, n := range e.Nodes {
+		var sources []string
+		switch {
+		case n.ObjectType == "TABLE" && n.estimatedOneRow():
+			sources = []string{n.Object}
+		case n.isLowestMisestimate(thresholds):
+			sources = n.SourceTables()
+		default:
+			continue
+		}
+
+		// Rows read with the wrong estimate, the estimate without ANALYZE
+		rows := float64(n.Rows) * float64(n.Processes())
+		if estimated, actual, ok := n.RowEstimate(); ok {
+			rows = actual
+			if estimated > actual {
+				rows = estimated
+			}
+		}
+		for _, s := range sources {
+			add(s, n, rows)
+		}
+	}
+
+	// ORCA scans partitioned tables with a Dynamic Table Scan and
+	// selects partitions for it with "Partition Selector for sales"
+	for _, n := range e.Nodes {
+		if t, ok := tables[RootTable(n.Object)]; ok && patterns["DYNAMIC_TABLE_SCAN"].MatchString(n.Operator) {
+			t.Partitioned = true
+		}
+		if patterns["PARTITION_SELECTOR"].MatchString(n.Operator) {
+			for name, t := range tables {
+				if strings.Contains(n.Operator, " for "+name+" ") || strings.HasSuffix(n.Operator, " for "+name) {
+					t.Partitioned = true
+				}
+			}
+		}
+	}
+
+	stale := []StaleTable{}
+	for _, name := range order {
+		stale = append(stale, *tables[name])
+	}
+	sort.SliceStable(stale, func(i, j int) bool {
+		return stale[i].Rows > stale[j].Rows
+	})
+	return stale
+}
+
+// ANALYZE statements for the stale tables, most rows first. ORCA uses
+// the root partition statistics so only those are gathered, the legacy
+// planner uses the statistics of each partition it scans
+//     ANALYZE ROOTPARTITION sales;
+//     ANALYZE customer;
+// Empty if no tables look stale
+func (e *Explain) AnalyzeScript() string {
+	stale := e.StaleStatistics()
+	if len(stale) == 0 {
+		return ""
+	}
+
+	script := "-- Tables with stale statistics, most rows read with the wrong estimate first\n"
+	for _, t := range stale {
+		script += fmt.Sprintf("-- %s: %.0f rows, nodes %s\n", t.Table, t.Rows, joinInts(t.NodeIDs))
+		switch {
+		case t.Partitioned && e.OptimizerScope() == ScopeOrca && e.Dialect != "postgres":
+			script += fmt.Sprintf("ANALYZE ROOTPARTITION %s;\n", t.Table)
+		case t.Partitioned && e.OptimizerScope() == ScopeLegacy && len(t.Partitions) > 0:
+			for _, p := range t.Partitions {
+				script += fmt.Sprintf("ANALYZE %s;\n", p)
+			}
+		default:
+			script += fmt.Sprintf("ANALYZE %s;\n", t.Table)
+		}
+	}
+	return script
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func joinInts(values []int) string {
+	s := []string{}
+	for _, v := range values {
+		s = append(s, fmt.Sprintf("%d", v))
+	}
+	return strings.Join(s, ", ")
+}
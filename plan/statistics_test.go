@@ -0,0 +1,75 @@
+package plan
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRootTable(t *testing.T) {
+	tests := map[string]string{
+		"sales_1_prt_outlying_years":     "sales",
+		"sales_1_prt_2013_2_prt_east":    "sales",
+		"trn_purch_detail_1_prt_p201601": "trn_purch_detail",
+		"sales":                          "sales",
+		"sales_prt":                      "sales_prt",
+		"sales_1_prt_":                   "sales_1_prt_",
+		"_1_prt_2013":                    "_1_prt_2013",
+		"sales__prt_2013":                "sales__prt_2013",
+		"sales_x1_prt_2013":              "sales_x1_prt_2013",
+		"sales_x_prt_a_1_prt_b":          "sales_x_prt_a",
+	}
+	for object, expected := range tests {
+		if got := RootTable(object); got != expected {
+			t.Errorf("%s: expected %s, got %s", object, expected, got)
+		}
+	}
+}
+
+func TestExplain_analyzeScript(t *testing.T) {
+	// ORCA only needs the root partition analyzed
+	explain := parseFileWithOptions(t, "explain05.txt", Options{})
+	stale := explain.StaleStatistics()
+	if len(stale) != 1 || stale[0].Table != "sales" || !stale[0].Partitioned || len(stale[0].NodeIDs) != 2 {
+		t.Fatalf("Expected sales to be stale, got %+v", stale)
+	}
+	expected := "-- Tables with stale statistics, most rows read with the wrong estimate first\n" +
+		"-- sales: 11005500 rows, nodes 4, 9\n" +
+		"ANALYZE ROOTPARTITION sales;\n"
+	if script := explain.AnalyzeScript(); script != expected {
+		t.Errorf("Unexpected script:\n%s", script)
+	}
+
+	// The legacy planner uses the statistics of each partition
+	explain = parseFileWithOptions(t, "explain12.txt", Options{})
+	stale = explain.StaleStatistics()
+	if len(stale) != 2 || stale[0].Table != "trn_purch_detail" || stale[0].Partitions[0] != "trn_purch_detail_1_prt_p201601" {
+		t.Fatalf("Expected the partitions to be grouped by table, got %+v", stale)
+	}
+	if script := explain.AnalyzeScript(); !strings.Contains(script, "ANALYZE trn_purch_header_1_prt_p201601;\n") {
+		t.Errorf("Expected the partition to be analyzed, got:\n%s", script)
+	}
+
+	explain = parseFileWithOptions(t, "explain03.txt", Options{})
+	if script := explain.AnalyzeScript(); script != "" {
+		t.Errorf("Expected no script, got:\n%s", script)
+	}
+}
+
+func TestCheck_staleStatistics(t *testing.T) {
+	explain := parseFileWithOptions(t, "explain15.txt", Options{EnableChecks: []string{"stale-statistics"}})
+
+	warnings := explain.AllWarnings()
+	if len(warnings) != 1 {
+		t.Fatalf("Expected 1 warning, got %v", warnings)
+	}
+	w := warnings[0]
+	if w.Node != nil || w.Params["nodes"] != 2 || len(w.Params["tables"].([]string)) != 3 {
+		t.Errorf("Unexpected warning %+v", w)
+	}
+
+	// A single node is left to its own warning
+	explain = parseFileWithOptions(t, "explain18.txt", Options{EnableChecks: []string{"stale-statistics"}})
+	if len(explain.AllWarnings()) != 0 {
+		t.Errorf("Expected no warnings, got %v", explain.AllWarnings())
+	}
+}
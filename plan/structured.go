@@ -0,0 +1,444 @@
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The structured EXPLAIN formats all describe the same property tree:
+//     {"Plan": {"Node Type": "Seq Scan", ..., "Plans": [...]}, "Settings": {...}, ...}
+// Each format is decoded in to the following generic values and then
+// turned in to Nodes/Plans by buildStructured():
+//     *propMap      object/element with named children
+//     []interface{} array/list
+//     string, float64, bool, nil
+type propMap struct {
+	Keys   []string // Keep the source order so ExtraInfo reads the same way
+	Values map[string]interface{}
+}
+
+func newPropMap() *propMap {
+	return &propMap{Values: map[string]interface{}{}}
+}
+
+func (m *propMap) set(key string, value interface{}) {
+	if _, ok := m.Values[key]; !ok {
+		m.Keys = append(m.Keys, key)
+	}
+	m.Values[key] = value
+}
+
+func (m *propMap) has(key string) bool {
+	_, ok := m.Values[key]
+	return ok
+}
+
+func (m *propMap) str(key string) string {
+	if v, ok := m.Values[key]; ok {
+		return propText(v)
+	}
+	return ""
+}
+
+func (m *propMap) num(key string) (float64, bool) {
+	switch v := m.Values[key].(type) {
+	case float64:
+		return v, true
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return f, true
+		}
+	}
+	return 0, false
+}
+
+func (m *propMap) list(key string) []interface{} {
+	switch v := m.Values[key].(type) {
+	case []interface{}:
+		return v
+	case nil:
+		return nil
+	default:
+		return []interface{}{v}
+	}
+}
+
+// Convert any decoded value to text the way psql would print it
+func propText(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		if t {
+			return "true"
+		}
+		return "false"
+	case []interface{}:
+		items := []string{}
+		for _, i := range t {
+			items = append(items, propText(i))
+		}
+		return strings.Join(items, ", ")
+	case *propMap:
+		items := []string{}
+		for _, k := range t.Keys {
+			items = append(items, fmt.Sprintf("%s: %s", k, propText(t.Values[k])))
+		}
+		return strings.Join(items, ", ")
+	}
+	return ""
+}
+
+// Keys which are converted to Node fields directly so are not
+// added to ExtraInfo
+var structuredNodeKeys = map[string]bool{
+	"Node Type":           true,
+	"Strategy":            true,
+	"Join Type":           true,
+	"Parent Relationship": true,
+	"Subplan Name":        true,
+	"Relation Name":       true,
+	"Schema":              true,
+	"Alias":               true,
+	"Index Name":          true,
+	"Scan Direction":      true,
+	"CTE Name":            true,
+	"Function Name":       true,
+	"Dynamic Scan Id":     true,
+	"Senders":             true,
+	"Receivers":           true,
+	"Slice":               true,
+	"Segments":            true,
+	"Gang Type":           true,
+	"Startup Cost":        true,
+	"Total Cost":          true,
+	"Plan Rows":           true,
+	"Plan Width":          true,
+	"Actual Startup Time": true,
+	"Actual Total Time":   true,
+	"Actual Rows":         true,
+	"Actual Loops":        true,
+	"Partitions selected": true,
+	"Partitions scanned":  true,
+	"Partitions total":    true,
+	"Workfile Spilling":   true,
+	"Workfile Reused":     true,
+	"Parallel Aware":      true,
+	"Async Capable":       true,
+	"Inner Unique":        true,
+	"Plans":               true,
+}
+
+// Find the object holding "Plan". Depending on the format it is either
+// the top level object or the first item in a list/wrapper element
+func findStructuredQuery(v interface{}) *propMap {
+	switch t := v.(type) {
+	case *propMap:
+		if t.has("Plan") {
+			return t
+		}
+		for _, k := range t.Keys {
+			if q := findStructuredQuery(t.Values[k]); q != nil {
+				return q
+			}
+		}
+	case []interface{}:
+		for _, i := range t {
+			if q := findStructuredQuery(i); q != nil {
+				return q
+			}
+		}
+	}
+	return nil
+}
+
+// Populate Nodes/Plans and the statement level fields from a decoded
+// structured plan. Nodes are linked as they are created so BuildTree()
+// is not required.
+func (e *Explain) buildStructured(root interface{}) error {
+	e.logDebugf("buildStructured\n")
+
+	query := findStructuredQuery(root)
+	if query == nil {
+		return errors.New("Could not find any nodes in plan")
+	}
+
+	top, ok := query.Values["Plan"].(*propMap)
+	if !ok {
+		return errors.New("Could not find any nodes in plan")
+	}
+
+	e.Plans = append(e.Plans, e.createPlan("Plan"))
+	e.Plans[0].TopNode = e.buildStructuredNode(top, 0)
+
+	// Settings:  optimizer=on
+	if settings, ok := query.Values["Settings"].(*propMap); ok {
+		for _, k := range settings.Keys {
+			value := propText(settings.Values[k])
+			e.Settings = append(e.Settings, Setting{k, value})
+			if k == "optimizer" {
+				e.Optimizer = value
+			}
+		}
+	}
+
+	// Optimizer status: PQO version 1.620
+	if query.has("Optimizer") {
+		e.setOptimizerStatus(query.str("Optimizer"))
+	}
+
+	// Planning time: 2.452 ms
+	if v, ok := query.num("Planning Time"); ok {
+		e.PlanningTime = KnownFloat(v)
+	}
+
+	// Slice statistics:
+	//   (slice1)    Executor memory: 187K bytes avg x 2 workers, 187K bytes max (seg0).
+	for _, s := range query.list("Slice statistics") {
+		if stat, ok := s.(*propMap); ok {
+			e.SliceStats = append(e.SliceStats, parseSliceStat(structuredSliceStat(stat)))
+		}
+	}
+
+	// Statement statistics:
+	//   Memory used: 128000K bytes
+	if stats, ok := query.Values["Statement statistics"].(*propMap); ok {
+		if v, ok := stats.num("Memory used"); ok {
+			e.MemoryUsed = KnownInt(int64(v))
+		}
+		if v, ok := stats.num("Memory wanted"); ok {
+			e.MemoryWanted = KnownInt(int64(v))
+		}
+	}
+
+	// Total runtime: 5.095 ms
+	if v, ok := query.num("Execution Time"); ok {
+		e.Runtime = KnownFloat(v)
+	} else if v, ok := query.num("Total Runtime"); ok {
+		e.Runtime = KnownFloat(v)
+	}
+
+	return nil
+}
+
+// Create a Node from a "Plan" object and recurse in to its "Plans"
+func (e *Explain) buildStructuredNode(props *propMap, depth int) *Node {
+	n := new(Node)
+	n.logger = e.logger
+	n.Init()
+	n.Indent = depth
+	n.Offset = len(e.Nodes)
+	e.Nodes = append(e.Nodes, n)
+
+	n.Operator = structuredOperator(props)
+	parseNodeObject(n)
+
+	if v, ok := props.num("Slice"); ok {
+		n.Slice = KnownInt(int64(v))
+	}
+
+	n.StartupCost, _ = props.num("Startup Cost")
+	n.TotalCost, _ = props.num("Total Cost")
+	if v, ok := props.num("Plan Rows"); ok {
+		n.Rows = int64(v)
+	}
+	if v, ok := props.num("Plan Width"); ok {
+		n.Width = int64(v)
+	}
+
+	// EXPLAIN ANALYZE
+	if v, ok := props.num("Actual Rows"); ok {
+		n.IsAnalyzed = true
+		n.ActualRows = KnownFloat(v)
+	}
+	if v, ok := props.num("Actual Total Time"); ok {
+		n.IsAnalyzed = true
+		n.MsEnd = KnownFloat(v)
+	}
+	if v, ok := props.num("Actual Startup Time"); ok {
+		n.MsFirst = KnownFloat(v)
+	}
+	if v, ok := props.num("Actual Loops"); ok {
+		n.Loops = KnownInt(int64(v))
+	}
+
+	if v, ok := props.num("Workfile Spilling"); ok {
+		n.SpillFile = KnownInt(int64(v))
+		n.SpillReuse = KnownInt(0)
+		if r, ok := props.num("Workfile Reused"); ok {
+			n.SpillReuse = KnownInt(int64(r))
+		}
+	}
+
+	total := OptionalInt{}
+	if v, ok := props.num("Partitions total"); ok {
+		total = KnownInt(int64(v))
+	}
+	if v, ok := props.num("Partitions selected"); ok {
+		n.PartSelected = KnownInt(int64(v))
+		n.PartSelectedTotal = total
+	}
+	if v, ok := props.num("Partitions scanned"); ok {
+		n.PartScanned = KnownInt(int64(v))
+		n.PartScannedTotal = total
+	}
+
+	// Line 0 is the node line as it would appear in text format
+	header := n.Operator
+	if n.Slice.Valid {
+		if v, ok := props.num("Segments"); ok {
+			header += fmt.Sprintf("  (slice%d; segments: %d)", n.Slice, int64(v))
+		} else {
+			header += fmt.Sprintf("  (slice%d)", n.Slice)
+		}
+	}
+	header += fmt.Sprintf("  (cost=%.2f..%.2f rows=%d width=%d)", n.StartupCost, n.TotalCost, n.Rows, n.Width)
+	n.ExtraInfo = []string{header}
+	parseNodeMotion(n, header)
+
+	// Everything else is kept as "Key: value" lines
+	for _, k := range props.Keys {
+		if structuredNodeKeys[k] {
+			continue
+		}
+		n.ExtraInfo = append(n.ExtraInfo, fmt.Sprintf("%s: %s", k, propText(props.Values[k])))
+	}
+
+	// Let the text parser pick up anything it understands (Filter etc...)
+	// while keeping the values set above
+	msFirst := n.MsFirst
+	parseNodeDetails(n)
+	if msFirst.Valid {
+		n.MsFirst = msFirst
+	}
+
+	for _, c := range props.list("Plans") {
+		child, ok := c.(*propMap)
+		if !ok {
+			continue
+		}
+
+		relationship := child.str("Parent Relationship")
+		if relationship == "SubPlan" || relationship == "InitPlan" {
+			plan := new(Plan)
+			plan.Name = child.str("Subplan Name")
+			if plan.Name == "" {
+				plan.Name = relationship
+			}
+			plan.Indent = depth + 1
+			plan.Offset = len(e.Nodes)
+			e.Plans = append(e.Plans, plan)
+			plan.TopNode = e.buildStructuredNode(child, depth+2)
+			n.SubPlans = append(n.SubPlans, plan)
+		} else {
+			n.SubNodes = append(n.SubNodes, e.buildStructuredNode(child, depth+1))
+		}
+	}
+
+	return n
+}
+
+// Build the operator name as it would appear in text format, e.g.
+//     Seq Scan on sales_1_prt_16 sales
+//     Index Scan using sales_idx on sales s
+//     Hash Left Join
+//     Redistribute Motion 2:2
+func structuredOperator(props *propMap) string {
+	nodeType := props.str("Node Type")
+	operator := nodeType
+
+	switch nodeType {
+	case "Aggregate":
+		switch props.str("Strategy") {
+		case "Sorted":
+			operator = "GroupAggregate"
+		case "Hashed":
+			operator = "HashAggregate"
+		case "Mixed":
+			operator = "MixedAggregate"
+		}
+	case "Hash Join", "Merge Join", "Nested Loop":
+		joinType := props.str("Join Type")
+		if joinType != "" && joinType != "Inner" {
+			operator = strings.TrimSuffix(nodeType, " Join") + " " + joinType + " Join"
+		}
+	}
+
+	if strings.HasSuffix(nodeType, "Motion") {
+		senders, sok := props.num("Senders")
+		receivers, rok := props.num("Receivers")
+		if sok && rok {
+			operator += fmt.Sprintf(" %d:%d", int64(senders), int64(receivers))
+		}
+	}
+
+	if props.str("Scan Direction") == "Backward" {
+		operator += " Backward"
+	}
+
+	if props.has("Index Name") {
+		if strings.HasPrefix(nodeType, "Bitmap Index") {
+			operator += " on " + props.str("Index Name")
+		} else {
+			operator += " using " + props.str("Index Name")
+		}
+	}
+
+	object := props.str("Relation Name")
+	if object == "" {
+		object = props.str("CTE Name")
+	}
+	if object == "" {
+		object = props.str("Function Name")
+	}
+	if object != "" {
+		if nodeType == "Partition Selector" {
+			operator += " for " + object
+		} else {
+			operator += " on " + object
+		}
+		if alias := props.str("Alias"); alias != "" && alias != object {
+			operator += " " + alias
+		}
+	}
+
+	if props.has("Dynamic Scan Id") {
+		operator += fmt.Sprintf(" (dynamic scan id: %s)", props.str("Dynamic Scan Id"))
+	}
+
+	return operator
+}
+
+// Build the slice statistics line as it would appear in text format
+//     (slice0)    Executor memory: 267K bytes.
+//     (slice1)    Executor memory: 187K bytes avg x 2 workers, 187K bytes max (seg0).
+func structuredSliceStat(stat *propMap) string {
+	line := fmt.Sprintf("(slice%s)    Executor memory: ", stat.str("Slice"))
+
+	if mem, ok := stat.Values["Executor Memory"].(*propMap); ok {
+		line += fmt.Sprintf("%sK bytes avg x %s workers, %sK bytes max",
+			mem.str("Average"),
+			mem.str("Workers"),
+			mem.str("Maximum Memory Used"))
+		if mem.has("Maximum Segment") {
+			line += fmt.Sprintf(" (seg%s)", mem.str("Maximum Segment"))
+		}
+		line += "."
+	} else {
+		line += fmt.Sprintf("%sK bytes.", stat.str("Executor Memory"))
+	}
+
+	if stat.has("Work Maximum Memory") {
+		line += fmt.Sprintf("  Work_mem: %sK bytes max", stat.str("Work Maximum Memory"))
+		if stat.has("Work Memory Wanted") {
+			line += fmt.Sprintf(", %sK bytes wanted", stat.str("Work Memory Wanted"))
+		}
+		line += "."
+	}
+
+	return line
+}
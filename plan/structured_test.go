@@ -0,0 +1,72 @@
+package plan
+
+import "testing"
+
+// Each structured fixture must produce the same tree and warnings as
+// the text version of the plan. explain02.json is in json_test.go
+func TestStructured_matchesText(t *testing.T) {
+	tests := []struct {
+		file   string
+		format string
+	}{
+		{"explain02.xml", "xml"},
+		{"explain02.yaml", "yaml"},
+		{"explain06.json", "json"},
+		{"explain06.xml", "xml"},
+		{"explain06.yaml", "yaml"},
+	}
+
+	for _, test := range tests {
+		text := Explain{}
+		err := text.InitFromFile("../testdata/"+test.file[:9]+".txt", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		explain := Explain{}
+		err = explain.InitFromFile("../testdata/"+test.file, false)
+		if err != nil {
+			t.Fatalf("%s: %s", test.file, err)
+		}
+
+		if explain.Format != test.format {
+			t.Errorf("%s: expected %s format, got %s", test.file, test.format, explain.Format)
+		}
+
+		if len(explain.Nodes) != len(text.Nodes) {
+			t.Fatalf("%s: expected %d nodes, got %d", test.file, len(text.Nodes), len(explain.Nodes))
+		}
+
+		if len(explain.Plans) != len(text.Plans) {
+			t.Errorf("%s: expected %d plans, got %d", test.file, len(text.Plans), len(explain.Plans))
+		}
+
+		for i, n := range explain.Nodes {
+			expected := text.Nodes[i]
+			if n.Operator != expected.Operator {
+				t.Errorf("%s: node %d operator %q, expected %q", test.file, i, n.Operator, expected.Operator)
+			}
+			if n.Filter != expected.Filter {
+				t.Errorf("%s: node %d filter %q, expected %q", test.file, i, n.Filter, expected.Filter)
+			}
+			if len(n.SubNodes) != len(expected.SubNodes) || len(n.SubPlans) != len(expected.SubPlans) {
+				t.Errorf("%s: node %d has different children", test.file, i)
+			}
+			if len(n.Warnings) != len(expected.Warnings) {
+				t.Errorf("%s: node %d has %d warnings, expected %d", test.file, i, len(n.Warnings), len(expected.Warnings))
+			}
+		}
+
+		if len(explain.Warnings) != len(text.Warnings) {
+			t.Errorf("%s: expected %d warnings, got %d", test.file, len(text.Warnings), len(explain.Warnings))
+		}
+
+		if explain.Runtime != text.Runtime || explain.OptimizerStatus != text.OptimizerStatus || explain.MemoryUsed != text.MemoryUsed {
+			t.Errorf("%s: statement level fields do not match text format", test.file)
+		}
+
+		if len(explain.SliceStats) != len(text.SliceStats) {
+			t.Errorf("%s: expected %d slice stats, got %d", test.file, len(text.SliceStats), len(explain.SliceStats))
+		}
+	}
+}
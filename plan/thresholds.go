@@ -0,0 +1,309 @@
+package plan
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Limits used by the checks. The defaults are what the checks have
+// always used, change them with a config file, Options.Thresholds or
+// the -threshold flag
+type Thresholds struct {
+	PartitionScans      float64 // Partitions scanned or selected by one node
+	PartitionPrct       float64 // Percentage of all partitions scanned or selected
+	DataSkewRows        float64 // Only look for skew on nodes with at least this many rows
+	MotionCount         float64 // Broadcast and Redistribute motions in the plan
+	SliceCount          float64
+	HashChainMax        float64
+	HashChainAvg        float64 // Only reported when less than HashBucketPrct of the buckets are used
+	HashBucketPrct      float64
+	MisestimateRatio    float64 // Actual rows this many times more or less than estimated
+	MisestimateRows     float64 // Only when the estimate or actual is at least this many rows
+	BroadcastMB         float64 // Sent by a Broadcast Motion to all its segments
+	BroadcastCriticalMB float64
+	JoinInputRows       float64 // Rows per segment for a large join input
+	HashBuildRatio      float64 // Hashed input this many times larger than the probe input
+	CartesianRows       float64 // Outer x inner rows per segment compared by a Nested Loop
+}
+
+func DefaultThresholds() Thresholds {
+	return Thresholds{
+		PartitionScans:      100,
+		PartitionPrct:       25,
+		DataSkewRows:        10000,
+		MotionCount:         5,
+		SliceCount:          100,
+		HashChainMax:        100,
+		HashChainAvg:        10,
+		HashBucketPrct:      1,
+		MisestimateRatio:    100,
+		MisestimateRows:     10000,
+		BroadcastMB:         1024,
+		BroadcastCriticalMB: 10240,
+		JoinInputRows:       100000,
+		HashBuildRatio:      10,
+		CartesianRows:       1000000,
+	}
+}
+
+// Names used in config files, flags and the webservice
+func (t *Thresholds) field(name string) *float64 {
+	switch name {
+	case "partition_scans":
+		return &t.PartitionScans
+	case "partition_prct":
+		return &t.PartitionPrct
+	case "data_skew_rows":
+		return &t.DataSkewRows
+	case "motion_count":
+		return &t.MotionCount
+	case "slice_count":
+		return &t.SliceCount
+	case "hash_chain_max":
+		return &t.HashChainMax
+	case "hash_chain_avg":
+		return &t.HashChainAvg
+	case "hash_bucket_prct":
+		return &t.HashBucketPrct
+	case "misestimate_ratio":
+		return &t.MisestimateRatio
+	case "misestimate_rows":
+		return &t.MisestimateRows
+	case "broadcast_mb":
+		return &t.BroadcastMB
+	case "broadcast_critical_mb":
+		return &t.BroadcastCriticalMB
+	case "join_input_rows":
+		return &t.JoinInputRows
+	case "hash_build_ratio":
+		return &t.HashBuildRatio
+	case "cartesian_rows":
+		return &t.CartesianRows
+	}
+	return nil
+}
+
+var thresholdNames = []string{
+	"partition_scans",
+	"partition_prct",
+	"data_skew_rows",
+	"motion_count",
+	"slice_count",
+	"hash_chain_max",
+	"hash_chain_avg",
+	"hash_bucket_prct",
+	"misestimate_ratio",
+	"misestimate_rows",
+	"broadcast_mb",
+	"broadcast_critical_mb",
+	"join_input_rows",
+	"hash_build_ratio",
+	"cartesian_rows",
+}
+
+func ThresholdNames() []string {
+	return append([]string{}, thresholdNames...)
+}
+
+func (t *Thresholds) Set(name string, value float64) error {
+	f := t.field(name)
+	if f == nil {
+		return errors.New(fmt.Sprintf("Unknown threshold %s", name))
+	}
+	if value < 0 {
+		return errors.New(fmt.Sprintf("Threshold %s can not be negative", name))
+	}
+	*f = value
+	return nil
+}
+
+func (t Thresholds) Get(name string) (float64, bool) {
+	f := t.field(name)
+	if f == nil {
+		return 0, false
+	}
+	return *f, true
+}
+
+// Set from "name=value", e.g. from the command line
+func (t *Thresholds) SetString(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 {
+		return errors.New(fmt.Sprintf("Expected name=value, got %s", s))
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Threshold %s is not a number", parts[0]))
+	}
+	return t.Set(strings.TrimSpace(parts[0]), value)
+}
+
+// All thresholds as name=value so a report shows what was used
+//     partition_scans=100 partition_prct=25 data_skew_rows=10000 ...
+func (t Thresholds) String() string {
+	values := []string{}
+	for _, name := range thresholdNames {
+		value, _ := t.Get(name)
+		values = append(values, fmt.Sprintf("%s=%s", name, strconv.FormatFloat(value, 'f', -1, 64)))
+	}
+	return strings.Join(values, " ")
+}
+
+// Written to JSON by name so the report matches the config file
+func (t Thresholds) MarshalJSON() ([]byte, error) {
+	values := map[string]float64{}
+	for _, name := range thresholdNames {
+		values[name], _ = t.Get(name)
+	}
+	return json.Marshal(values)
+}
+
+// Settings read from a config file. Anything not in the file keeps its
+// default value
+//     thresholds:
+//       motion_count: 8
+//       data_skew_rows: 100000
+//     rules:
+//       - id: fact-seq-scan
+//         when: operator =~ "^Seq Scan" && object =~ "^fact_"
+// or the same in JSON
+//     {"thresholds": {"motion_count": 8, "data_skew_rows": 100000}}
+type Config struct {
+	Thresholds Thresholds
+	Rules      []Rule // See rules.go
+}
+
+func DefaultConfig() Config {
+	return Config{Thresholds: DefaultThresholds()}
+}
+
+func LoadConfig(filename string) (Config, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return Config{}, err
+	}
+	config, err := ParseConfig(string(data))
+	if err != nil {
+		return Config{}, errors.New(fmt.Sprintf("%s: %s", filename, err))
+	}
+	return config, nil
+}
+
+// Config in YAML or JSON, JSON if it starts with "{"
+func ParseConfig(text string) (Config, error) {
+	config := DefaultConfig()
+
+	var root map[string]interface{}
+	if strings.HasPrefix(strings.TrimSpace(text), "{") {
+		if err := json.Unmarshal([]byte(text), &root); err != nil {
+			return config, err
+		}
+	} else {
+		values, err := parseYAMLConfig(text)
+		if err != nil {
+			return config, err
+		}
+		root = values
+	}
+
+	for key, value := range root {
+		switch key {
+		case "thresholds":
+			thresholds, ok := configMap(value)
+			if !ok {
+				return config, errors.New("thresholds should be a mapping of name to value")
+			}
+			if err := config.Thresholds.setAll(thresholds); err != nil {
+				return config, err
+			}
+		case "rules":
+			rules, err := parseRules(value)
+			if err != nil {
+				return config, err
+			}
+			config.Rules = rules
+		default:
+			return config, errors.New(fmt.Sprintf("Unknown setting %s", key))
+		}
+	}
+
+	// Report bad rules when the file is loaded rather than when it is used
+	if _, err := config.Registry(); err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+// The built in checks and the rules, DefaultRegistry if there are no
+// rules
+func (c Config) Registry() (*Registry, error) {
+	if len(c.Rules) == 0 {
+		return DefaultRegistry, nil
+	}
+	r := NewRegistry()
+	for _, rule := range c.Rules {
+		if err := r.AddRule(rule); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Set in name order so the error is the same every time
+func (t *Thresholds) setAll(values map[string]interface{}) error {
+	names := []string{}
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, ok := values[name].(float64)
+		if !ok {
+			return errors.New(fmt.Sprintf("Threshold %s is not a number", name))
+		}
+		if err := t.Set(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Mappings are map[string]interface{} from JSON and *propMap from YAML
+func configMap(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case *propMap:
+		return v.Values, true
+	}
+	return nil, false
+}
+
+// Uses the EXPLAIN (FORMAT YAML) parser, see yaml.go
+func parseYAMLConfig(text string) (map[string]interface{}, error) {
+	p := newYAMLParser(text)
+	if len(p.lines) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	root, err := p.parseBlock()
+	if err == nil && p.pos < len(p.lines) {
+		err = p.errorf("unexpected indentation")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	values, ok := configMap(root)
+	if !ok {
+		return nil, errors.New("Config should be a mapping")
+	}
+	return values, nil
+}
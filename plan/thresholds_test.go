@@ -0,0 +1,96 @@
+package plan
+
+import (
+	"encoding/json"
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	yamlText := `# planchecker.yaml
+thresholds:
+  motion_count: 8
+  data_skew_rows: 100000
+`
+	jsonText := `{"thresholds": {"motion_count": 8, "data_skew_rows": 100000}}`
+
+	for _, text := range []string{yamlText, jsonText} {
+		config, err := ParseConfig(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := DefaultThresholds()
+		expected.MotionCount = 8
+		expected.DataSkewRows = 100000
+		if config.Thresholds != expected {
+			t.Errorf("Expected %s, got %s", expected, config.Thresholds)
+		}
+	}
+
+	expectedErrors := map[string]string{
+		"thresholds:\n  motion_cnt: 8\n":      "Unknown threshold motion_cnt",
+		"thresholds:\n  motion_count: x\n":    "Threshold motion_count is not a number",
+		"threshold:\n  motion_count: 8\n":     "Unknown setting threshold",
+		`{"thresholds": {"slice_count": -1}}`: "Threshold slice_count can not be negative",
+	}
+	for text, expected := range expectedErrors {
+		if _, err := ParseConfig(text); err == nil || err.Error() != expected {
+			t.Errorf("Expected %q, got %v", expected, err)
+		}
+	}
+}
+
+func TestThresholds_check(t *testing.T) {
+	// 5 motions, the default limit
+	explain := parseFileWithOptions(t, "explain12.txt", Options{})
+	if len(explain.Warnings) != 1 || explain.Warnings[0].CheckID != "motion-count" {
+		t.Fatalf("Expected a motion-count warning, got %v", explain.Warnings)
+	}
+
+	thresholds := DefaultThresholds()
+	thresholds.MotionCount = 6
+	explain = parseFileWithOptions(t, "explain12.txt", Options{Thresholds: &thresholds})
+	if len(explain.Warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", explain.Warnings)
+	}
+
+	// The report shows what was used
+	data, err := json.Marshal(explain.Report())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"motion_count":6`) {
+		t.Errorf("Expected the thresholds in the report, got %s", data)
+	}
+	if !strings.Contains(explain.Thresholds.String(), "motion_count=6 slice_count=100") {
+		t.Errorf("Unexpected thresholds %s", explain.Thresholds)
+	}
+}
+
+func TestFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := AddFlags(fs)
+	err := fs.Parse([]string{"-threshold", "motion_count=6", "-threshold", "slice_count=50", "-disable", "spilling, scans"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := flags.Options(Options{Lenient: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.Lenient || opts.Thresholds.MotionCount != 6 || opts.Thresholds.SliceCount != 50 || opts.Thresholds.DataSkewRows != 10000 {
+		t.Errorf("Unexpected options %+v", opts)
+	}
+	if len(opts.DisableChecks) != 2 || opts.DisableChecks[1] != "scans" || len(opts.EnableChecks) != 0 {
+		t.Errorf("Unexpected checks %v %v", opts.EnableChecks, opts.DisableChecks)
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(new(strings.Builder))
+	AddFlags(fs)
+	if err := fs.Parse([]string{"-threshold", "motion_count"}); err == nil {
+		t.Error("Expected an error for a threshold without a value")
+	}
+}
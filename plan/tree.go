@@ -0,0 +1,196 @@
+package plan
+
+import (
+	"regexp"
+)
+
+// Called for each node by Walk. Return false to skip the nodes below it
+type WalkFunc func(n *Node) bool
+
+// Set the ID, Depth and parent links of every node. The tree is built
+// differently for each format so this runs once it is complete
+func (e *Explain) linkTree() {
+	for i, n := range e.Nodes {
+		n.ID = i
+		n.Depth = 0
+		n.Parent = nil
+		n.ParentPlan = nil
+	}
+	for _, p := range e.Plans {
+		p.Parent = nil
+	}
+
+	if len(e.Plans) == 0 || e.Plans[0].TopNode == nil {
+		return
+	}
+
+	var link func(n *Node)
+	link = func(n *Node) {
+		for _, s := range n.SubNodes {
+			s.Parent = n
+			s.Depth = n.Depth + 1
+			link(s)
+		}
+		for _, p := range n.SubPlans {
+			p.Parent = n
+			if p.TopNode != nil {
+				p.TopNode.Parent = n
+				p.TopNode.ParentPlan = p
+				p.TopNode.Depth = n.Depth + 1
+				link(p.TopNode)
+			}
+		}
+	}
+	link(e.Plans[0].TopNode)
+}
+
+// Nodes directly below n, SubNodes first then the top nodes of SubPlans
+func (n *Node) Children() []*Node {
+	children := []*Node{}
+	children = append(children, n.SubNodes...)
+	for _, p := range n.SubPlans {
+		if p.TopNode != nil {
+			children = append(children, p.TopNode)
+		}
+	}
+	return children
+}
+
+// Visit n and the nodes below it depth first in the order they are in
+// the plan
+//     n.Walk(func(s *Node) bool {
+//         fmt.Println(s.Operator)
+//         return s.MotionType == ""   // Stop at the next slice
+//     })
+func (n *Node) Walk(fn WalkFunc) {
+	if fn(n) == false {
+		return
+	}
+	for _, c := range n.Children() {
+		c.Walk(fn)
+	}
+}
+
+// Visit every node in the plan starting from the top node
+func (e *Explain) Walk(fn WalkFunc) {
+	if len(e.Plans) == 0 || e.Plans[0].TopNode == nil {
+		return
+	}
+	e.Plans[0].TopNode.Walk(fn)
+}
+
+// Parent first up to the top node
+func (n *Node) Ancestors() []*Node {
+	ancestors := []*Node{}
+	for p := n.Parent; p != nil; p = p.Parent {
+		ancestors = append(ancestors, p)
+	}
+	return ancestors
+}
+
+// All nodes below n in the order Walk visits them, n is not included
+func (n *Node) Descendants() []*Node {
+	descendants := []*Node{}
+	for _, c := range n.Children() {
+		c.Walk(func(s *Node) bool {
+			descendants = append(descendants, s)
+			return true
+		})
+	}
+	return descendants
+}
+
+// The closest node above n matching fn or nil, e.g. the join a scan
+// feeds in to
+//     join := n.FindAncestor(func(a *Node) bool { return a.IsJoin() })
+func (n *Node) FindAncestor(fn func(*Node) bool) *Node {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if fn(p) {
+			return p
+		}
+	}
+	return nil
+}
+
+// True if m is somewhere below n
+func (n *Node) IsAncestorOf(m *Node) bool {
+	for p := m.Parent; p != nil; p = p.Parent {
+		if p == n {
+			return true
+		}
+	}
+	return false
+}
+
+// Nodes below n matching fn
+func (n *Node) FindDescendants(fn func(*Node) bool) []*Node {
+	found := []*Node{}
+	for _, d := range n.Descendants() {
+		if fn(d) {
+			found = append(found, d)
+		}
+	}
+	return found
+}
+
+// Slice the node runs in. Nodes without a slice label run in the same
+// slice as the node above, the top node runs on the QD in slice 0. A
+// motion node is labelled with its sending slice, see SliceEdge
+func (n *Node) OwningSlice() int64 {
+	for s := n; s != nil; s = s.Parent {
+		if s.Slice.Valid {
+			return s.Slice.Value
+		}
+	}
+	return 0
+}
+
+// Joins are the nodes with two inputs which match on a condition
+func (n *Node) IsJoin() bool {
+	return matchPattern("JOIN", n.Operator) || n.HashCond != "" || n.MergeCond != ""
+}
+
+// Node with the given ID or nil
+func (e *Explain) NodeByID(id int) *Node {
+	if id < 0 || id >= len(e.Nodes) {
+		return nil
+	}
+	return e.Nodes[id]
+}
+
+// All nodes matching fn in the order they are in the plan
+func (e *Explain) FindNodes(fn func(*Node) bool) []*Node {
+	found := []*Node{}
+	for _, n := range e.Nodes {
+		if fn(n) {
+			found = append(found, n)
+		}
+	}
+	return found
+}
+
+// Nodes where the operator matches the regular expression, e.g. "Hash Join"
+// or "^(Seq|Dynamic Table) Scan"
+func (e *Explain) FindByOperator(expr string) ([]*Node, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return e.FindNodes(func(n *Node) bool {
+		return re.MatchString(n.Operator)
+	}), nil
+}
+
+// Nodes which read the table or index
+func (e *Explain) FindByObject(object string) []*Node {
+	return e.FindNodes(func(n *Node) bool {
+		return n.Object == object
+	})
+}
+
+// Nodes running in the slice, see OwningSlice
+func (e *Explain) FindBySlice(slice int64) []*Node {
+	return e.FindNodes(func(n *Node) bool {
+		return n.OwningSlice() == slice
+	})
+}
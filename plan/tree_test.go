@@ -0,0 +1,89 @@
+package plan
+
+import (
+	"testing"
+)
+
+func TestTree_subPlans(t *testing.T) {
+	for _, file := range []string{"explain06.txt", "explain06.json"} {
+		explain := Explain{}
+		err := explain.InitFromFile("../testdata/"+file, false)
+		if err != nil {
+			t.Fatalf("%s: %s", file, err)
+		}
+
+		top := explain.Plans[0].TopNode
+		if top.ID != 0 || top.Parent != nil || top.Depth != 0 {
+			t.Errorf("%s: unexpected top node ID %d depth %d", file, top.ID, top.Depth)
+		}
+
+		for i, n := range explain.Nodes {
+			if n.ID != i || explain.NodeByID(i) != n {
+				t.Errorf("%s: expected ID %d, got %d", file, i, n.ID)
+			}
+		}
+
+		// Limit is the top node of SubPlan 2 so its parent is the Seq Scan
+		limit := explain.Nodes[1]
+		if limit.Parent != top || limit.ParentPlan == nil || limit.ParentPlan.Parent != top || limit.Depth != 1 {
+			t.Errorf("%s: unexpected SubPlan top node %+v", file, limit.ParentPlan)
+		}
+
+		scan := explain.Nodes[2]
+		if scan.Parent != limit || scan.Depth != 2 || !top.IsAncestorOf(scan) || scan.IsAncestorOf(top) {
+			t.Errorf("%s: unexpected parent of %s", file, scan.Operator)
+		}
+		if ancestors := scan.Ancestors(); len(ancestors) != 2 || ancestors[0] != limit || ancestors[1] != top {
+			t.Errorf("%s: unexpected ancestors %v", file, ancestors)
+		}
+
+		if len(top.Descendants()) != 4 {
+			t.Errorf("%s: expected 4 descendants, got %d", file, len(top.Descendants()))
+		}
+
+		visited := 0
+		explain.Walk(func(n *Node) bool {
+			visited++
+			// Skip everything below the SubPlans
+			return n.ParentPlan == nil
+		})
+		if visited != 3 {
+			t.Errorf("%s: expected to visit 3 nodes, got %d", file, visited)
+		}
+	}
+}
+
+func TestTree_find(t *testing.T) {
+	explain := Explain{}
+	err := explain.InitFromFile("../testdata/explain01.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scans, err := explain.FindByOperator("^Dynamic Table Scan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scans) != 1 || scans[0].Object != "sales" {
+		t.Fatalf("Expected the Dynamic Table Scan on sales, got %v", scans)
+	}
+	if len(explain.FindByObject("sales")) != 1 {
+		t.Errorf("Expected 1 node reading sales, got %d", len(explain.FindByObject("sales")))
+	}
+
+	// Everything below the Gather Motion runs in slice1
+	if scans[0].OwningSlice() != 1 || len(explain.FindBySlice(1)) != len(explain.Nodes) {
+		t.Errorf("Expected all nodes in slice1, got slice%d", scans[0].OwningSlice())
+	}
+
+	sequence := scans[0].FindAncestor(func(n *Node) bool {
+		return n.Operator == "Sequence"
+	})
+	if sequence == nil || sequence != scans[0].Parent {
+		t.Errorf("Expected the Sequence node above the scan, got %v", sequence)
+	}
+
+	if _, err := explain.FindByOperator("("); err == nil {
+		t.Errorf("Expected an error for an invalid expression")
+	}
+}
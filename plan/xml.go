@@ -0,0 +1,120 @@
+package plan
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Elements which always hold a list even when there is only one child
+var xmlListElements = map[string]bool{
+	"Plans":            true,
+	"Slice statistics": true,
+	"Triggers":         true,
+}
+
+// ------------------------------------------------------------
+// EXPLAIN (ANALYZE, FORMAT XML)
+// <explain xmlns="http://www.postgresql.org/2009/explain">
+//   <Query>
+//     <Plan>
+//       <Node-Type>Seq Scan</Node-Type>
+//       <Relation-Name>sales</Relation-Name>
+//       ...
+//       <Plans>
+//         <Plan>
+//           ...
+//         </Plan>
+//       </Plans>
+//     </Plan>
+//     <Execution-Time>5.095</Execution-Time>
+//   </Query>
+// </explain>
+//
+// Element names use "-" instead of " " so are converted back to the
+// JSON style key names before being passed to buildStructured()
+func (e *Explain) parseXML(plantext string) error {
+	e.logDebugf("parseXML\n")
+
+	dec := xml.NewDecoder(strings.NewReader(plantext))
+
+	// Find the root element
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if err == io.EOF {
+				return errors.New("Could not find any nodes in plan")
+			}
+			return e.xmlError(plantext, dec, err)
+		}
+
+		if start, ok := tok.(xml.StartElement); ok {
+			root, err := decodeXMLElement(dec, start)
+			if err != nil {
+				return e.xmlError(plantext, dec, err)
+			}
+			return e.buildStructured(root)
+		}
+	}
+}
+
+// Decode an element and all of its children. Elements containing
+// other elements become a *propMap or []interface{}, anything else
+// becomes a string
+func decodeXMLElement(dec *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	name := xmlKeyName(start.Name.Local)
+
+	text := ""
+	children := newPropMap()
+	items := []interface{}{}
+	isList := xmlListElements[name]
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			child, err := decodeXMLElement(dec, t)
+			if err != nil {
+				return nil, err
+			}
+
+			childName := xmlKeyName(t.Name.Local)
+			if childName == "Item" || children.has(childName) {
+				isList = true
+			}
+			children.set(childName, child)
+			items = append(items, child)
+
+		case xml.CharData:
+			text += string(t)
+
+		case xml.EndElement:
+			if isList {
+				return items, nil
+			}
+			if len(children.Keys) > 0 {
+				return children, nil
+			}
+			return strings.TrimSpace(text), nil
+		}
+	}
+}
+
+func (e *Explain) xmlError(plantext string, dec *xml.Decoder, err error) error {
+	line, column := offsetPosition(plantext, dec.InputOffset())
+	if syntaxErr, ok := err.(*xml.SyntaxError); ok {
+		// The decoder has read past the error, the line is accurate
+		return e.structuredError("XML", plantext, Diagnostic{Line: syntaxErr.Line, Message: syntaxErr.Msg})
+	}
+	return e.structuredError("XML", plantext, Diagnostic{Line: line, Column: column, Message: err.Error()})
+}
+
+// Node-Type -> Node Type
+func xmlKeyName(name string) string {
+	return strings.Replace(name, "-", " ", -1)
+}
@@ -0,0 +1,225 @@
+package plan
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Only the subset of YAML produced by EXPLAIN (FORMAT YAML) is
+// supported: block mappings, block sequences and scalars which are
+// either plain or double quoted
+type yamlLine struct {
+	Number int // Line number in the input, used for errors
+	Indent int
+	Text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// ------------------------------------------------------------
+// EXPLAIN (ANALYZE, FORMAT YAML)
+// - Plan:
+//     Node Type: "Gather Motion"
+//     Senders: 2
+//     Receivers: 1
+//     ...
+//     Plans:
+//       - Node Type: "Sequence"
+//         Parent Relationship: "Outer"
+//         ...
+//   Settings:
+//     optimizer: "on"
+//   Execution Time: 5.095
+//
+func (e *Explain) parseYAML(plantext string) error {
+	e.logDebugf("parseYAML\n")
+
+	p := newYAMLParser(plantext)
+	if len(p.lines) == 0 {
+		return errors.New("Could not find any nodes in plan")
+	}
+
+	root, err := p.parseBlock()
+	if err == nil && p.pos < len(p.lines) {
+		err = p.errorf("unexpected indentation")
+	}
+	if err != nil {
+		d, ok := err.(Diagnostic)
+		if !ok {
+			d = Diagnostic{Message: err.Error()}
+		}
+		return e.structuredError("YAML", plantext, d)
+	}
+
+	return e.buildStructured(root)
+}
+
+// Blank lines, comments and document markers are skipped
+func newYAMLParser(text string) *yamlParser {
+	p := new(yamlParser)
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" || trimmed == "..." || trimmed[:1] == "#" {
+			continue
+		}
+		p.lines = append(p.lines, yamlLine{i + 1, getIndent(line), trimmed})
+	}
+	return p
+}
+
+func (p *yamlParser) errorf(format string, v ...interface{}) error {
+	line := p.lines[len(p.lines)-1]
+	if p.pos < len(p.lines) {
+		line = p.lines[p.pos]
+	}
+	return Diagnostic{Line: line.Number, Column: line.Indent + 1, Message: fmt.Sprintf(format, v...)}
+}
+
+// Parse the block starting at the current line
+func (p *yamlParser) parseBlock() (interface{}, error) {
+	line := p.lines[p.pos]
+	if isYAMLSequenceItem(line.Text) {
+		return p.parseSequence(line.Indent)
+	}
+	return p.parseMapping(line.Indent)
+}
+
+// - item
+// - key: value
+//   key: value
+func (p *yamlParser) parseSequence(indent int) ([]interface{}, error) {
+	list := []interface{}{}
+
+	for p.pos < len(p.lines) && p.lines[p.pos].Indent == indent && isYAMLSequenceItem(p.lines[p.pos].Text) {
+		line := p.lines[p.pos]
+		rest := strings.TrimSpace(line.Text[1:])
+
+		if rest == "" {
+			// Item is a block on the following lines
+			p.pos++
+			if p.pos < len(p.lines) && p.lines[p.pos].Indent > indent {
+				value, err := p.parseBlock()
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, value)
+			} else {
+				list = append(list, nil)
+			}
+		} else if _, _, ok := splitYAMLKey(rest); ok || isYAMLSequenceItem(rest) {
+			// Item is a block starting on this line.
+			// Replace the "- " with spaces and parse it as normal
+			p.lines[p.pos] = yamlLine{line.Number, indent + len(line.Text) - len(rest), rest}
+			value, err := p.parseBlock()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		} else {
+			value, err := parseYAMLScalar(rest)
+			if err != nil {
+				return nil, p.errorf("%s", err)
+			}
+			list = append(list, value)
+			p.pos++
+		}
+	}
+
+	return list, nil
+}
+
+// key: value
+// key:
+//   nested: value
+func (p *yamlParser) parseMapping(indent int) (*propMap, error) {
+	m := newPropMap()
+
+	for p.pos < len(p.lines) && p.lines[p.pos].Indent == indent && !isYAMLSequenceItem(p.lines[p.pos].Text) {
+		key, rest, ok := splitYAMLKey(p.lines[p.pos].Text)
+		if !ok {
+			return nil, p.errorf("expected \"key: value\"")
+		}
+		p.pos++
+
+		var value interface{}
+		if rest == "" {
+			// Nested block, sequences may start at the same indent as the key
+			if p.pos < len(p.lines) {
+				next := p.lines[p.pos]
+				if next.Indent > indent || (next.Indent == indent && isYAMLSequenceItem(next.Text)) {
+					v, err := p.parseBlock()
+					if err != nil {
+						return nil, err
+					}
+					value = v
+				}
+			}
+		} else {
+			v, err := parseYAMLScalar(rest)
+			if err != nil {
+				p.pos--
+				return nil, p.errorf("%s", err)
+			}
+			value = v
+		}
+		m.set(key, value)
+	}
+
+	if p.pos < len(p.lines) && p.lines[p.pos].Indent > indent {
+		return nil, p.errorf("unexpected indentation")
+	}
+
+	return m, nil
+}
+
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// Split "key: value" and "key:"
+func splitYAMLKey(text string) (string, string, bool) {
+	if strings.HasSuffix(text, ":") {
+		return text[:len(text)-1], "", true
+	}
+	i := strings.Index(text, ": ")
+	if i < 1 || text[:1] == `"` {
+		return "", "", false
+	}
+	return text[:i], strings.TrimSpace(text[i+2:]), true
+}
+
+// Convert a scalar to string, float64, bool or nil
+func parseYAMLScalar(text string) (interface{}, error) {
+	switch {
+	case text[:1] == `"`:
+		// Double quoted strings use the same escapes as JSON
+		var s string
+		if err := json.Unmarshal([]byte(text), &s); err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid quoted string %s", text))
+		}
+		return s, nil
+	case text[:1] == `'`:
+		if len(text) < 2 || text[len(text)-1:] != `'` {
+			return nil, errors.New(fmt.Sprintf("invalid quoted string %s", text))
+		}
+		return strings.Replace(text[1:len(text)-1], "''", "'", -1), nil
+	case text == "true":
+		return true, nil
+	case text == "false":
+		return false, nil
+	case text == "null" || text == "~":
+		return nil, nil
+	}
+
+	if f, err := strconv.ParseFloat(text, 64); err == nil {
+		return f, nil
+	}
+	return text, nil
+}
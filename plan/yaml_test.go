@@ -0,0 +1,46 @@
+package plan
+
+import "testing"
+
+func TestYAML_sequenceAtKeyIndent(t *testing.T) {
+	input := `- Plan:
+    Node Type: "Sort"
+    Startup Cost: 1.00
+    Total Cost: 2.00
+    Plan Rows: 10
+    Plan Width: 4
+    Sort Key:
+    - "a"
+    - "b"
+    Plans:
+    - Node Type: "Seq Scan"
+      Relation Name: "t"
+      Alias: "t"
+      Startup Cost: 0.00
+      Total Cost: 1.00
+      Plan Rows: 10
+      Plan Width: 4
+`
+	explain := Explain{}
+	err := explain.InitFromString(input, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(explain.Nodes) != 2 || explain.Nodes[1].Object != "t" {
+		t.Fatal("Expected Sort with Seq Scan on t")
+	}
+
+	if explain.Nodes[0].ExtraInfo[1] != "Sort Key: a, b" {
+		t.Fatalf("Unexpected ExtraInfo %q", explain.Nodes[0].ExtraInfo[1])
+	}
+}
+
+func TestYAML_badIndent(t *testing.T) {
+	input := "- Plan:\n    Node Type: \"Sort\"\n      Total Cost: 2.00\n"
+	explain := Explain{}
+	err := explain.InitFromString(input, false)
+	if err == nil {
+		t.Fatal("Expected indentation error")
+	}
+}
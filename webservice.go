@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"database/sql"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"io/ioutil"
+	"log"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -35,6 +39,10 @@ var (
 
 	// Database constring
 	dbconnstring string
+
+	// Check thresholds and rules, loaded from the CONFIG file if set
+	config   = plan.DefaultConfig()
+	registry = plan.DefaultRegistry
 )
 
 // Generate random string
@@ -155,25 +163,50 @@ func InsertPlan(planText string) (PlanRecord, error) {
 func GenerateChecklistHtml() string {
 	checks := ""
 	checks += "<table class=\"table table-bordered table-condensed table-striped\">\n"
-	checks += "<tr><th class=\"text-left\">Description</th><th class=\"text-left\">Optimizer</th><th class=\"text-left\">Added</th></tr>"
-	for _, c := range plan.NODECHECKS {
+	checks += "<tr><th class=\"text-left\">ID</th><th class=\"text-left\">Description</th><th class=\"text-left\">Category</th><th class=\"text-left\">Severity</th><th class=\"text-left\">Optimizer</th><th class=\"text-left\">Added</th></tr>"
+	for _, c := range registry.Checks() {
 		scope := ""
 		for _, s := range c.Scope {
 			scope += fmt.Sprintf(" <span class=\"label optimizer-%[1]s\">%[1]s</span> ", s)
 		}
-		checks += fmt.Sprintf("<tr><td>%s</td><td class=\"nowrap\">%s</td><td class=\"nowrap\">%s</td></tr>", c.Description, scope, c.CreatedAt)
-	}
-	for _, c := range plan.EXPLAINCHECKS {
-		scope := ""
-		for _, s := range c.Scope {
-			scope += fmt.Sprintf(" <span class=\"label optimizer-%[1]s\">%[1]s</span> ", s)
+		// Rules from the config file have no date
+		added := c.CreatedAt
+		if added == "" {
+			added = "config"
 		}
-		checks += fmt.Sprintf("<tr><td>%s</td><td class=\"nowrap\">%s</td><td class=\"nowrap\">%s</td></tr>", c.Description, scope, c.CreatedAt)
+		checks += fmt.Sprintf("<tr><td class=\"nowrap\">%s</td><td>%s</td><td>%s</td><td>%s</td><td class=\"nowrap\">%s</td><td class=\"nowrap\">%s</td></tr>",
+			html.EscapeString(c.ID), html.EscapeString(c.Description), html.EscapeString(c.Category), c.Severity, scope, added)
 	}
 	checks += "</table>\n"
 	return checks
 }
 
+// Inputs for the thresholds, left empty to use the configured value
+func GenerateThresholdsHtml() string {
+	inputs := ""
+	for _, name := range plan.ThresholdNames() {
+		value, _ := config.Thresholds.Get(name)
+		inputs += fmt.Sprintf("<div class=\"col-sm-3\"><label for=\"threshold_%[1]s\">%[1]s</label><input class=\"form-control input-sm\" type=\"number\" min=\"0\" step=\"any\" name=\"threshold_%[1]s\" id=\"threshold_%[1]s\" placeholder=\"%[2]v\"></div>\n",
+			name, value)
+	}
+	return inputs
+}
+
+// Thresholds from the config file with any set in the form
+func RequestThresholds(r *http.Request) (plan.Thresholds, error) {
+	thresholds := config.Thresholds
+	for _, name := range plan.ThresholdNames() {
+		value := strings.TrimSpace(r.FormValue("threshold_" + name))
+		if value == "" {
+			continue
+		}
+		if err := thresholds.SetString(name + "=" + value); err != nil {
+			return thresholds, err
+		}
+	}
+	return thresholds, nil
+}
+
 func IndexHandler(w http.ResponseWriter, r *http.Request) {
 	// Load HTML
 	pageHtml := LoadHtml("templates/index.html")
@@ -181,10 +214,10 @@ func IndexHandler(w http.ResponseWriter, r *http.Request) {
 	// Get list of checks from planchecker
 	checklistHtml := GenerateChecklistHtml()
 
-	pageHtml = fmt.Sprintf(pageHtml, checklistHtml)
+	pageHtml = fmt.Sprintf(pageHtml, GenerateThresholdsHtml(), checklistHtml)
 
 	// Print the response
-	fmt.Fprintf(w, pageHtml)
+	fmt.Fprint(w, pageHtml)
 }
 
 func PlanRefHandler(w http.ResponseWriter, r *http.Request) {
@@ -246,13 +279,15 @@ func PlanPostHandler(w http.ResponseWriter, r *http.Request) {
 		// Insert into database
 		planRecord, err = InsertPlan(string(planTextDecoded))
 		if err != nil {
-			fmt.Fprintf(w, fmt.Sprintf("{\"status\":\"failure\",\"msg\":\"%s\"}", err.Error()))
+			fmt.Fprintf(w, "{\"status\":\"failure\",\"msg\":\"%s\"}", err.Error())
 		} else {
 			fmt.Fprintf(w, "{\"status\":\"success\",\"ref\":\"%s\"}", planRecord.Ref)
 		}
 
 	} else if action == "parse" {
 		GenerateExplain(w, r, planRecord, true)
+	} else if action == "report" {
+		GenerateReport(w, r, planRecord)
 	} else {
 		fmt.Fprintf(w, "Oops... no action specified")
 	}
@@ -260,11 +295,20 @@ func PlanPostHandler(w http.ResponseWriter, r *http.Request) {
 
 func GenerateExplain(w http.ResponseWriter, r *http.Request, planRecord PlanRecord, isNew bool) {
 
-	// Create new explain object
-	var explain plan.Explain
+	thresholds, err := RequestThresholds(r)
+	if err != nil {
+		fmt.Fprintf(w, "<!DOCTYPE html><pre>Oops... %s\n\n<a href=\"/\">Back</a></pre>", html.EscapeString(err.Error()))
+		return
+	}
 
-	// Init the explain from string
-	err := explain.InitFromString(planRecord.Plantext, true)
+	// Init an explain for each plan in the text
+	// Lenient so users still get a plan when some lines can't be parsed
+	explains, err := plan.ParseAll(r.Context(), strings.NewReader(planRecord.Plantext), plan.Options{
+		Logger:     log.New(os.Stdout, "", 0),
+		Lenient:    true,
+		Thresholds: &thresholds,
+		Registry:   registry,
+	})
 	if err != nil {
 		fmt.Fprintf(w, "<!DOCTYPE html><pre>Oops... we had a problem parsing the plan:\n--\n%s\n\n<a href=\"/\">Back</a></pre>", err)
 		return
@@ -274,7 +318,13 @@ func GenerateExplain(w http.ResponseWriter, r *http.Request, planRecord PlanReco
 
 	// Generate the plan HTML
 	//planHtml := explain.PrintPlanHtml()
-	planHtml := RenderExplainHtml(&explain)
+	planHtml := ""
+	for i, explain := range explains {
+		if len(explains) > 1 {
+			planHtml += fmt.Sprintf("<h4>Plan %d of %d</h4>\n", i+1, len(explains))
+		}
+		planHtml += RenderExplainHtml(explain)
+	}
 
 	// Load HTML page
 	pageHtml := LoadHtml("templates/plan.html")
@@ -286,6 +336,36 @@ func GenerateExplain(w http.ResponseWriter, r *http.Request, planRecord PlanReco
 		planRecord.Ref)
 }
 
+// Warnings, checks and diagnostics for each plan as JSON
+func GenerateReport(w http.ResponseWriter, r *http.Request, planRecord PlanRecord) {
+	w.Header().Set("Content-Type", "application/json")
+
+	thresholds, err := RequestThresholds(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		msg, _ := json.Marshal(err.Error())
+		fmt.Fprintf(w, "{\"status\":\"failure\",\"msg\":%s}", msg)
+		return
+	}
+
+	explains, err := plan.ParseAll(r.Context(), strings.NewReader(planRecord.Plantext), plan.Options{Lenient: true, Thresholds: &thresholds, Registry: registry})
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		msg, _ := json.Marshal(err.Error())
+		fmt.Fprintf(w, "{\"status\":\"failure\",\"msg\":%s}", msg)
+		return
+	}
+
+	data, err := plan.ReportsJSON(explains)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		msg, _ := json.Marshal(err.Error())
+		fmt.Fprintf(w, "{\"status\":\"failure\",\"msg\":%s}", msg)
+		return
+	}
+	w.Write(data)
+}
+
 // Render node for output to HTML
 func RenderNodeHtml(n *plan.Node, indent int) string {
 	indent += 1
@@ -295,7 +375,7 @@ func RenderNodeHtml(n *plan.Node, indent int) string {
 
 	HTML := fmt.Sprintf("<tr><td style=\"padding-left:%dpx\">", indentPixels)
 
-	if n.Slice > -1 {
+	if n.Slice.Valid {
 		HTML += fmt.Sprintf("   <span class=\"label label-success\">Slice %d</span>\n",
 			n.Slice)
 	}
@@ -312,7 +392,7 @@ func RenderNodeHtml(n *plan.Node, indent int) string {
 	}
 
 	for _, w := range n.Warnings {
-		HTML += fmt.Sprintf("   <span class=\"label label-danger\">WARNING: %s | %s</span>\n", w.Cause, w.Resolution)
+		HTML += fmt.Sprintf("   %s\n", RenderWarningHtml(w))
 	}
 
 	HTML += "</td>"
@@ -322,20 +402,20 @@ func RenderNodeHtml(n *plan.Node, indent int) string {
 			"<td class=\"text-right\">%s</td>"+
 			"<td class=\"text-right\">%.0f</td>"+
 			"<td class=\"text-right\">%.0f</td>"+
-			"<td class=\"text-right\">%.0f%%</td>"+
+			"<td class=\"text-right\">%s</td>"+
 			"<td class=\"text-right\">%.0f</td>"+
 			"<td class=\"text-right\">%d</td>\n",
 		n.Object,
 		n.ObjectType,
 		n.StartupCost,
 		n.NodeCost,
-		n.PrctCost,
+		percent(n.PrctCost),
 		n.TotalCost,
 		n.Rows)
 
 	if n.IsAnalyzed == true {
 		colspan = 13
-		if n.ActualRows > -1 {
+		if n.ActualRows.Valid {
 			HTML += fmt.Sprintf(
 				"<td class=\"text-right\">%.0f</td>"+
 					"<td class=\"text-right\">%s</td>"+
@@ -350,12 +430,12 @@ func RenderNodeHtml(n *plan.Node, indent int) string {
 			HTML += fmt.Sprintf(
 				"<td class=\"text-right\">%.0f</td>"+
 					"<td class=\"text-right\">%.0f</td>"+
-					"<td class=\"text-right\">%.0f%%</td>"+
+					"<td class=\"text-right\">%s</td>"+
 					"<td class=\"text-right\">%.0f</td>"+
 					"<td class=\"text-right\">%.0f</td>",
 				n.MsFirst,
 				n.MsNode,
-				n.MsPrct,
+				percent(n.MsPrct),
 				n.MsEnd,
 				n.MsOffset)
 		} else {
@@ -372,12 +452,12 @@ func RenderNodeHtml(n *plan.Node, indent int) string {
 			HTML += fmt.Sprintf(
 				"<td class=\"text-right\">%.0f</td>"+
 					"<td class=\"text-right\">%.0f</td>"+
-					"<td class=\"text-right\">%.0f%%</td>"+
+					"<td class=\"text-right\">%s</td>"+
 					"<td class=\"text-right\">%.0f</td>"+
 					"<td class=\"text-right\">%.0f</td>",
 				n.MsFirst,
 				n.MsNode,
-				n.MsPrct,
+				percent(n.MsPrct),
 				n.MsEnd,
 				n.MsOffset)
 		}
@@ -409,8 +489,115 @@ func RenderPlanHtml(p *plan.Plan, indent int, colspan int) string {
 	return HTML
 }
 
+// Label coloured by severity linking to the documentation for the check.
+// Hovering shows where it came from and the measured values
+func RenderWarningHtml(w plan.Warning) string {
+	class := "label-danger"
+	switch w.Severity {
+	case plan.SeverityWarning:
+		class = "label-warning"
+	case plan.SeverityInfo:
+		class = "label-info"
+	}
+
+	title := w.Source()
+	if len(w.Params) > 0 {
+		title += " " + w.Params.String()
+	}
+
+	label := fmt.Sprintf("%s: %s | %s", w.Label(), html.EscapeString(w.Cause), html.EscapeString(w.Resolution))
+	// Rules can set any URL in the config file
+	if u, err := url.Parse(w.DocURL); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		label = fmt.Sprintf("<a href=\"%s\" target=\"_blank\" style=\"color:inherit\">%s</a>", html.EscapeString(w.DocURL), label)
+	}
+	return fmt.Sprintf("<span class=\"label %s\" title=\"%s\">%s</span>", class, html.EscapeString(strings.TrimSpace(title)), label)
+}
+
+// Percentage without the "%" when it is not known
+func percent(v plan.OptionalFloat) string {
+	if !v.Valid {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", v.Value)
+}
+
+// Render slice statistics as a table, values not in the plan are shown
+// as "-"
+func RenderSliceStatsHtml(stats []plan.SliceStat) string {
+	HTML := `<table class="table table-condensed table-striped table-bordered">`
+	HTML += "<tr>" +
+		"<th>Slice</th>" +
+		"<th class=\"text-right\">Executor Memory Avg (KB)</th>" +
+		"<th class=\"text-right\">Workers</th>" +
+		"<th class=\"text-right\">Executor Memory Max (KB)</th>" +
+		"<th class=\"text-right\">Max Seg</th>" +
+		"<th class=\"text-right\">Work_mem (KB)</th>" +
+		"<th class=\"text-right\">Work_mem Wanted (KB)</th>" +
+		"</tr>\n"
+
+	for _, stat := range stats {
+		name := stat.Name
+		if stat.IsConstrained == true {
+			name += " <span class=\"label label-danger\">*</span>"
+		}
+		HTML += fmt.Sprintf(
+			"<tr><td>%s</td>"+
+				"<td class=\"text-right\">%d</td>"+
+				"<td class=\"text-right\">%d</td>"+
+				"<td class=\"text-right\">%d</td>"+
+				"<td class=\"text-right\">%s</td>"+
+				"<td class=\"text-right\">%d</td>"+
+				"<td class=\"text-right\">%d</td></tr>\n",
+			name,
+			stat.MemoryAvg,
+			stat.Workers,
+			stat.MemoryMax,
+			stat.MaxSeg,
+			stat.WorkMem,
+			stat.WorkMemWanted)
+	}
+
+	HTML += "</table>"
+	return HTML
+}
+
+// Render problems found while parsing, shown above the plan so it is
+// clear which lines were skipped or repaired
+func RenderDiagnosticsHtml(diagnostics []plan.Diagnostic) string {
+	HTML := `<table class="table table-condensed table-bordered">`
+	HTML += "<tr><th>Severity</th><th class=\"text-right\">Line</th><th class=\"text-right\">Column</th><th>Message</th><th>Text</th></tr>\n"
+
+	for _, d := range diagnostics {
+		label := "label-warning"
+		if d.Severity == plan.DiagnosticError {
+			label = "label-danger"
+		}
+		HTML += fmt.Sprintf(
+			"<tr><td><span class=\"label %s\">%s</span></td>"+
+				"<td class=\"text-right\">%d</td>"+
+				"<td class=\"text-right\">%d</td>"+
+				"<td>%s</td>"+
+				"<td><code>%s</code></td></tr>\n",
+			label,
+			d.Severity,
+			d.Line,
+			d.Column,
+			html.EscapeString(strings.SplitN(d.Message, "\n", 2)[0]),
+			html.EscapeString(strings.TrimSpace(d.Text)))
+	}
+
+	HTML += "</table>"
+	return HTML
+}
+
 func RenderExplainHtml(e *plan.Explain) string {
 	HTML := ""
+
+	if len(e.Diagnostics) > 0 {
+		HTML += fmt.Sprintf("<strong>Diagnostics:</strong>\n")
+		HTML += RenderDiagnosticsHtml(e.Diagnostics)
+	}
+
 	HTML += `<table class="table table-condensed table-striped table-bordered">`
 	HTML += "<tr>"
 	HTMLTH1 := "<tr>"
@@ -454,21 +641,42 @@ func RenderExplainHtml(e *plan.Explain) string {
 	if len(e.Warnings) > 0 {
 		HTML += fmt.Sprintf("<strong>Warnings:</strong>\n")
 		for _, w := range e.Warnings {
-			HTML += fmt.Sprintf("\t<span class=\"label label-danger\">%s | %s</span>\n", w.Cause, w.Resolution)
+			HTML += fmt.Sprintf("\t%s\n", RenderWarningHtml(w))
+		}
+	}
+
+	// Download the ANALYZE statements without another request
+	if script := e.AnalyzeScript(); script != "" {
+		HTML += fmt.Sprintf("<strong>Stale statistics:</strong>\n")
+		for _, t := range e.StaleStatistics() {
+			HTML += fmt.Sprintf("\t%s: %.0f rows\n", html.EscapeString(t.Table), t.Rows)
+		}
+		HTML += fmt.Sprintf("\t<a download=\"analyze.sql\" href=\"data:application/sql;base64,%s\">Download ANALYZE script</a>\n", base64.StdEncoding.EncodeToString([]byte(script)))
+	}
+
+	if len(e.Normalisations) > 0 {
+		HTML += fmt.Sprintf("<strong>Input normalised:</strong>\n")
+		for _, n := range e.Normalisations {
+			HTML += fmt.Sprintf("\t%s\n", html.EscapeString(n.String()))
+		}
+	}
+
+	if edges := e.SliceGraph(); len(edges) > 0 {
+		HTML += fmt.Sprintf("<strong>Slice graph:</strong>\n")
+		for _, edge := range edges {
+			HTML += fmt.Sprintf("\t%s\n", edge)
 		}
 	}
 
 	if len(e.SliceStats) > 0 {
 		HTML += fmt.Sprintf("<strong>Slice statistics:</strong>\n")
-		for _, stat := range e.SliceStats {
-			HTML += fmt.Sprintf("\t%s\n", stat)
-		}
+		HTML += RenderSliceStatsHtml(e.SliceStats)
 	}
 
-	if e.MemoryUsed > 0 {
+	if e.MemoryUsed.Valid {
 		HTML += fmt.Sprintf("<strong>Statement statistics:</strong>\n")
 		HTML += fmt.Sprintf("\tMemory used: %d\n", e.MemoryUsed)
-		if e.MemoryWanted > 0 {
+		if e.MemoryWanted.Valid {
 			HTML += fmt.Sprintf("\tMemory wanted: %d\n", e.MemoryWanted)
 		}
 	}
@@ -485,11 +693,28 @@ func RenderExplainHtml(e *plan.Explain) string {
 		HTML += fmt.Sprintf("\t%s\n", e.OptimizerStatus)
 	}
 
-	if e.Runtime > 0 {
+	if e.PlanningTime.Valid {
+		HTML += fmt.Sprintf("<strong>Planning time:</strong>\n")
+		HTML += fmt.Sprintf("\t%.3f ms\n", e.PlanningTime)
+	}
+
+	if e.Runtime.Valid {
 		HTML += fmt.Sprintf("<strong>Total runtime:</strong>\n")
 		HTML += fmt.Sprintf("\t%.0f ms\n", e.Runtime)
 	}
 
+	if len(e.CheckRuns) > 0 {
+		ran, skipped := e.CheckCounts()
+		HTML += fmt.Sprintf("<strong>Checks:</strong>\n")
+		HTML += fmt.Sprintf("\t%d ran, %d skipped\n", ran, skipped)
+		HTML += fmt.Sprintf("\tThresholds: %s\n", e.Thresholds)
+		for _, c := range e.CheckRuns {
+			if c.Status == plan.CheckSkipped {
+				HTML += fmt.Sprintf("\t%s\n", html.EscapeString(c.String()))
+			}
+		}
+	}
+
 	return HTML
 }
 
@@ -510,6 +735,20 @@ func main() {
 		fmt.Println("CONSTRING env variable not set. No database configured")
 	}
 
+	// Optional YAML or JSON file with the check thresholds
+	if configFile := os.Getenv("CONFIG"); configFile != "" {
+		var err error
+		config, err = plan.LoadConfig(configFile)
+		if err == nil {
+			registry, err = config.Registry()
+		}
+		if err != nil {
+			fmt.Printf("Could not load config: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Loaded config from %s\n", configFile)
+	}
+
 	// Using gorilla/mux as it provides named URL variable parsing
 	r := mux.NewRouter()
 